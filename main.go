@@ -1,23 +1,97 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	_ "image/gif"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/nlacasse/boss-radio/pkg/alsa"
 	"github.com/nlacasse/boss-radio/pkg/bradio"
+	"github.com/nlacasse/boss-radio/pkg/config"
+	"github.com/nlacasse/boss-radio/pkg/player"
+	"github.com/nlacasse/boss-radio/pkg/podcast"
 	"github.com/nlacasse/boss-radio/pkg/station"
 	"periph.io/x/host/v3"
 )
 
+var configPath = flag.String("config", "/etc/boss-radio.json", "path to the config file")
+
 func main() {
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("config.Load failed: %v", err)
+	}
+
 	if _, err := host.Init(); err != nil {
 		log.Fatalf("host.Init failed: %v", err)
 	}
 
-	br, err := bradio.NewBossRadio(station.AllStations)
+	switch flag.Arg(0) {
+	case "":
+	case "learn":
+		if err := bradio.Learn(cfg); err != nil {
+			log.Fatalf("Learn failed: %v", err)
+		}
+		if err := cfg.Save(*configPath); err != nil {
+			log.Fatalf("Save failed: %v", err)
+		}
+		log.Printf("saved key mappings to %s", *configPath)
+		return
+	case "controls":
+		card := cfg.Volume.Card
+		if flag.NArg() > 1 {
+			card = flag.Arg(1)
+		}
+		if err := listControls(card); err != nil {
+			log.Fatalf("listControls failed: %v", err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+
+	stns := station.AllStations
+	for _, s := range cfg.Streams {
+		if s.Type == config.StreamHLS {
+			stns = append(stns, station.NewHLSStation(s.Name, s.URL, nil, s.MaxBandwidth))
+			continue
+		}
+		var fbs []player.Source
+		for _, fb := range s.Fallbacks {
+			fbs = append(fbs, player.Source{URL: fb.URL, Bitrate: fb.Bitrate})
+		}
+		var meta *station.Metadata
+		if m := s.Metadata; m != nil {
+			meta = &station.Metadata{
+				URL:    m.URL,
+				XML:    m.XML,
+				ASCII:  m.ASCII,
+				Show:   m.Show,
+				Artist: m.Artist,
+				Track:  m.Track,
+				Album:  m.Album,
+			}
+		}
+		stns = append(stns, station.NewGeneric(s.Name, s.URL, meta, fbs...))
+	}
+	if cfg.Library.Dir != "" {
+		stns = append(stns, station.NewLibrary(cfg.Library.Dir, cfg.Library.Shuffle))
+	}
+	if pc := cfg.Podcasts; len(pc.Feeds) > 0 {
+		dir := pc.Dir
+		if dir == "" {
+			dir = cfg.DataPath("podcasts")
+		}
+		stns = append(stns, podcast.New(pc.Feeds, dir, pc.Keep, time.Duration(pc.Refresh)))
+	}
+	br, err := bradio.NewBossRadio(cfg, stns)
 	if err != nil {
 		log.Fatalf("NewBossRadio() failed: %v", err)
 	}
@@ -34,3 +108,21 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// listControls prints the mixer controls of an ALSA card, for choosing the
+// volume control in the config.
+func listControls(card string) error {
+	c, err := alsa.OpenCard(card)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctls, err := c.Controls()
+	if err != nil {
+		return err
+	}
+	for _, ctl := range ctls {
+		fmt.Println(ctl)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+// Package alsa talks to ALSA sound card mixers through the kernel's control
+// interface, /dev/snd/controlC*, without needing alsa-lib.
+package alsa
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Element types, from SNDRV_CTL_ELEM_TYPE_*.
+const (
+	TypeBoolean    = 1
+	TypeInteger    = 2
+	TypeEnumerated = 3
+	TypeBytes      = 4
+	TypeIEC958     = 5
+	TypeInteger64  = 6
+)
+
+// ifaceMixer is SNDRV_CTL_ELEM_IFACE_MIXER.
+const ifaceMixer = 2
+
+// TLV types, from SNDRV_CTL_TLVT_*.
+const (
+	tlvContainer   = 0
+	tlvDBScale     = 1
+	tlvDBLinear    = 2
+	tlvDBRange     = 3
+	tlvDBMinMax    = 4
+	tlvDBMinMaxMut = 5
+)
+
+// longSize is the size of a C long, which matches Go's int on Linux.
+const longSize = bits.UintSize / 8
+
+type ctlElemID struct {
+	Numid     uint32
+	Iface     int32
+	Device    uint32
+	Subdevice uint32
+	Name      [44]byte
+	Index     uint32
+}
+
+type ctlElemList struct {
+	Offset   uint32
+	Space    uint32
+	Used     uint32
+	Count    uint32
+	Pids     unsafe.Pointer
+	Reserved [50]byte
+}
+
+type ctlElemInfo struct {
+	ID       ctlElemID
+	Type     int32
+	Access   uint32
+	Count    uint32
+	Owner    int32
+	Value    [128]byte
+	Reserved [64]byte
+}
+
+type ctlElemValue struct {
+	ID       ctlElemID
+	Indirect uint32
+	_        uint32
+	Value    [128 * longSize]byte
+	Reserved [128]byte
+}
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'U'<<8 | nr
+}
+
+const iocRW = 3
+
+var (
+	ioctlElemList  = ioc(iocRW, 0x10, unsafe.Sizeof(ctlElemList{}))
+	ioctlElemInfo  = ioc(iocRW, 0x11, unsafe.Sizeof(ctlElemInfo{}))
+	ioctlElemRead  = ioc(iocRW, 0x12, unsafe.Sizeof(ctlElemValue{}))
+	ioctlElemWrite = ioc(iocRW, 0x13, unsafe.Sizeof(ctlElemValue{}))
+	ioctlTLVRead   = ioc(iocRW, 0x1a, 8)
+)
+
+// Card is an open sound card control device.
+type Card struct {
+	f *os.File
+}
+
+// OpenCard opens the card with the given number, like "0", or id, like
+// "sndrpihifiberry", as listed in /proc/asound/cards.
+func OpenCard(card string) (*Card, error) {
+	num, err := cardNumber(card)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fmt.Sprintf("/dev/snd/controlC%d", num), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Card{f: f}, nil
+}
+
+func cardNumber(card string) (int, error) {
+	if n, err := strconv.Atoi(card); err == nil {
+		return n, nil
+	}
+	// /proc/asound/<id> is a symlink to /proc/asound/card<n>.
+	target, err := os.Readlink(filepath.Join("/proc/asound", card))
+	if err != nil {
+		return 0, fmt.Errorf("unknown card %q: %w", card, err)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(target), "card"))
+	if err != nil {
+		return 0, fmt.Errorf("unknown card %q: bad link %q", card, target)
+	}
+	return n, nil
+}
+
+func (c *Card) Close() error {
+	return c.f.Close()
+}
+
+func (c *Card) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, c.f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Control is a mixer control element.
+type Control struct {
+	Numid uint32
+	Name  string
+	Index uint32
+	Type  int
+	// Count is the number of values, usually one per channel.
+	Count int
+	// Min, Max and Step are the range of integer controls.
+	Min, Max, Step int64
+	// DB maps values to decibels, if the control has a dB scale.
+	DB *DBScale
+}
+
+func (ctl *Control) String() string {
+	s := fmt.Sprintf("%q", ctl.Name)
+	if ctl.Index > 0 {
+		s += fmt.Sprintf(",%d", ctl.Index)
+	}
+	switch ctl.Type {
+	case TypeBoolean:
+		s += " switch"
+	case TypeInteger, TypeInteger64:
+		s += fmt.Sprintf(" volume %d..%d", ctl.Min, ctl.Max)
+	case TypeEnumerated:
+		s += " enum"
+	default:
+		s += fmt.Sprintf(" type %d", ctl.Type)
+	}
+	s += fmt.Sprintf(" x%d", ctl.Count)
+	if ctl.DB != nil {
+		min, max := ctl.DB.Range()
+		s += fmt.Sprintf(" (%.2fdB..%.2fdB)", float64(min)/100, float64(max)/100)
+	}
+	return s
+}
+
+// Controls lists the card's mixer controls.
+func (c *Card) Controls() ([]*Control, error) {
+	var list ctlElemList
+	if err := c.ioctl(ioctlElemList, unsafe.Pointer(&list)); err != nil {
+		return nil, fmt.Errorf("listing controls: %w", err)
+	}
+	if list.Count == 0 {
+		return nil, nil
+	}
+	ids := make([]ctlElemID, list.Count)
+	list.Space = list.Count
+	list.Pids = unsafe.Pointer(&ids[0])
+	err := c.ioctl(ioctlElemList, unsafe.Pointer(&list))
+	runtime.KeepAlive(ids)
+	if err != nil {
+		return nil, fmt.Errorf("listing controls: %w", err)
+	}
+
+	var ctls []*Control
+	for _, id := range ids[:list.Used] {
+		if id.Iface != ifaceMixer {
+			continue
+		}
+		ctl, err := c.info(id)
+		if err != nil {
+			return nil, err
+		}
+		ctls = append(ctls, ctl)
+	}
+	return ctls, nil
+}
+
+// Control returns the mixer control with the given name, like "Digital".
+func (c *Card) Control(name string) (*Control, error) {
+	ctls, err := c.Controls()
+	if err != nil {
+		return nil, err
+	}
+	for _, ctl := range ctls {
+		if ctl.Name == name {
+			return ctl, nil
+		}
+	}
+	return nil, fmt.Errorf("no control %q", name)
+}
+
+func (c *Card) info(id ctlElemID) (*Control, error) {
+	info := ctlElemInfo{ID: id}
+	if err := c.ioctl(ioctlElemInfo, unsafe.Pointer(&info)); err != nil {
+		return nil, fmt.Errorf("control %d info: %w", id.Numid, err)
+	}
+	ctl := &Control{
+		Numid: info.ID.Numid,
+		Name:  cString(info.ID.Name[:]),
+		Index: info.ID.Index,
+		Type:  int(info.Type),
+		Count: int(info.Count),
+	}
+	switch ctl.Type {
+	case TypeInteger:
+		ctl.Min = readLong(info.Value[0:])
+		ctl.Max = readLong(info.Value[longSize:])
+		ctl.Step = readLong(info.Value[2*longSize:])
+	case TypeInteger64:
+		ctl.Min = int64(binary.LittleEndian.Uint64(info.Value[0:]))
+		ctl.Max = int64(binary.LittleEndian.Uint64(info.Value[8:]))
+		ctl.Step = int64(binary.LittleEndian.Uint64(info.Value[16:]))
+	}
+	if ctl.Type == TypeInteger {
+		// Not all controls have a dB scale, so ignore errors.
+		if tlv, err := c.readTLV(ctl.Numid); err == nil {
+			ctl.DB = parseDBScale(tlv, ctl.Min, ctl.Max)
+		}
+	}
+	return ctl, nil
+}
+
+func (c *Card) readTLV(numid uint32) ([]uint32, error) {
+	const words = 64
+	buf := make([]uint32, 2+words)
+	buf[0] = numid
+	buf[1] = words * 4
+	err := c.ioctl(ioctlTLVRead, unsafe.Pointer(&buf[0]))
+	runtime.KeepAlive(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[2:], nil
+}
+
+// Values returns the control's integer values, one per channel.
+func (c *Card) Values(ctl *Control) ([]int64, error) {
+	v := ctlElemValue{ID: ctlElemID{Numid: ctl.Numid}}
+	if err := c.ioctl(ioctlElemRead, unsafe.Pointer(&v)); err != nil {
+		return nil, fmt.Errorf("reading %q: %w", ctl.Name, err)
+	}
+	vals := make([]int64, ctl.Count)
+	for i := range vals {
+		switch ctl.Type {
+		case TypeInteger64:
+			vals[i] = int64(binary.LittleEndian.Uint64(v.Value[8*i:]))
+		case TypeBoolean, TypeInteger:
+			vals[i] = readLong(v.Value[longSize*i:])
+		default:
+			return nil, fmt.Errorf("reading %q: unsupported type %d", ctl.Name, ctl.Type)
+		}
+	}
+	return vals, nil
+}
+
+// SetValue sets all of the control's channels to val.
+func (c *Card) SetValue(ctl *Control, val int64) error {
+	v := ctlElemValue{ID: ctlElemID{Numid: ctl.Numid}}
+	for i := 0; i < ctl.Count; i++ {
+		switch ctl.Type {
+		case TypeInteger64:
+			binary.LittleEndian.PutUint64(v.Value[8*i:], uint64(val))
+		case TypeBoolean, TypeInteger:
+			writeLong(v.Value[longSize*i:], val)
+		default:
+			return fmt.Errorf("writing %q: unsupported type %d", ctl.Name, ctl.Type)
+		}
+	}
+	if err := c.ioctl(ioctlElemWrite, unsafe.Pointer(&v)); err != nil {
+		return fmt.Errorf("writing %q: %w", ctl.Name, err)
+	}
+	return nil
+}
+
+func readLong(b []byte) int64 {
+	if longSize == 8 {
+		return int64(binary.LittleEndian.Uint64(b))
+	}
+	return int64(int32(binary.LittleEndian.Uint32(b)))
+}
+
+func writeLong(b []byte, v int64) {
+	if longSize == 8 {
+		binary.LittleEndian.PutUint64(b, uint64(v))
+		return
+	}
+	binary.LittleEndian.PutUint32(b, uint32(int32(v)))
+}
+
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
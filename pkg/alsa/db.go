@@ -0,0 +1,190 @@
+package alsa
+
+import "math"
+
+// dbRange maps raw values rawMin..rawMax linearly to dbMin..dbMax, in
+// hundredths of a dB.
+type dbRange struct {
+	rawMin, rawMax int64
+	dbMin, dbMax   int64
+	// mute is set if rawMin means silence rather than dbMin.
+	mute bool
+}
+
+// DBScale maps a control's raw values to decibels, from its TLV data.
+type DBScale struct {
+	ranges []dbRange
+}
+
+// parseDBScale parses the dB TLV of a control with values min..max. It
+// returns nil if tlv has no dB scale that we understand.
+func parseDBScale(tlv []uint32, min, max int64) *DBScale {
+	ranges := parseTLV(tlv, min, max)
+	if len(ranges) == 0 {
+		return nil
+	}
+	return &DBScale{ranges: ranges}
+}
+
+func parseTLV(tlv []uint32, min, max int64) []dbRange {
+	if len(tlv) < 2 {
+		return nil
+	}
+	typ, size := tlv[0], int(tlv[1]/4)
+	if size > len(tlv)-2 {
+		return nil
+	}
+	data := tlv[2 : 2+size]
+	switch typ {
+	case tlvContainer:
+		// Look for the first dB scale inside.
+		for len(data) >= 2 {
+			if r := parseTLV(data, min, max); r != nil {
+				return r
+			}
+			n := 2 + int((data[1]+3)/4)
+			if n > len(data) {
+				break
+			}
+			data = data[n:]
+		}
+	case tlvDBScale:
+		if len(data) < 2 {
+			return nil
+		}
+		step := int64(data[1] & 0xffff)
+		dbMin := int64(int32(data[0]))
+		return []dbRange{{
+			rawMin: min,
+			rawMax: max,
+			dbMin:  dbMin,
+			dbMax:  dbMin + step*(max-min),
+			mute:   data[1]&0x10000 != 0,
+		}}
+	case tlvDBMinMax, tlvDBMinMaxMut:
+		if len(data) < 2 {
+			return nil
+		}
+		return []dbRange{{
+			rawMin: min,
+			rawMax: max,
+			dbMin:  int64(int32(data[0])),
+			dbMax:  int64(int32(data[1])),
+			mute:   typ == tlvDBMinMaxMut,
+		}}
+	case tlvDBRange:
+		// Each entry is rawMin, rawMax and a nested dB TLV.
+		var ranges []dbRange
+		for len(data) >= 4 {
+			rmin, rmax := int64(data[0]), int64(data[1])
+			n := 2 + 2 + int((data[3]+3)/4)
+			if n > len(data) {
+				break
+			}
+			ranges = append(ranges, parseTLV(data[2:n], rmin, rmax)...)
+			data = data[n:]
+		}
+		return ranges
+	}
+	// tlvDBLinear and anything else: no usable dB scale.
+	return nil
+}
+
+// Range returns the lowest and highest levels, in hundredths of a dB.
+func (s *DBScale) Range() (min, max int64) {
+	min, max = s.ranges[0].dbMin, s.ranges[0].dbMax
+	for _, r := range s.ranges[1:] {
+		if r.dbMin < min {
+			min = r.dbMin
+		}
+		if r.dbMax > max {
+			max = r.dbMax
+		}
+	}
+	return min, max
+}
+
+// ToDB returns the level of raw value v, in hundredths of a dB.
+func (s *DBScale) ToDB(v int64) int64 {
+	r := s.find(v)
+	if v <= r.rawMin {
+		return r.dbMin
+	}
+	if v >= r.rawMax {
+		return r.dbMax
+	}
+	return r.dbMin + (v-r.rawMin)*(r.dbMax-r.dbMin)/(r.rawMax-r.rawMin)
+}
+
+// FromDB returns the raw value closest to the level db, in hundredths of a
+// dB.
+func (s *DBScale) FromDB(db int64) int64 {
+	for _, r := range s.ranges {
+		if db > r.dbMax {
+			continue
+		}
+		if db <= r.dbMin || r.dbMax == r.dbMin {
+			return r.rawMin
+		}
+		frac := float64(db-r.dbMin) / float64(r.dbMax-r.dbMin)
+		return r.rawMin + int64(math.Round(frac*float64(r.rawMax-r.rawMin)))
+	}
+	return s.ranges[len(s.ranges)-1].rawMax
+}
+
+func (s *DBScale) find(v int64) dbRange {
+	for _, r := range s.ranges {
+		if v <= r.rawMax {
+			return r
+		}
+	}
+	return s.ranges[len(s.ranges)-1]
+}
+
+// maxLinearDB is the widest range, in hundredths of a dB, over which volume
+// percentages are mapped linearly to raw values. Wider ranges are mapped
+// along a loudness curve instead, like alsamixer does.
+const maxLinearDB = 2400
+
+// Percent returns the volume of raw value v as a percentage.
+func (s *DBScale) Percent(v int64) int {
+	min, max := s.Range()
+	if max == min {
+		return 100
+	}
+	if max-min <= maxLinearDB {
+		db := s.ToDB(v)
+		return int(math.Round(100 * float64(db-min) / float64(max-min)))
+	}
+	norm := math.Pow(10, float64(s.ToDB(v)-max)/6000)
+	if !s.ranges[0].mute {
+		minNorm := math.Pow(10, float64(min-max)/6000)
+		norm = (norm - minNorm) / (1 - minNorm)
+	}
+	if s.ranges[0].mute && v <= s.ranges[0].rawMin {
+		return 0
+	}
+	return int(math.Round(100 * norm))
+}
+
+// FromPercent returns the raw value for a volume of pct percent, so that
+// equal steps in percent sound like equal steps in loudness.
+func (s *DBScale) FromPercent(pct int) int64 {
+	min, max := s.Range()
+	if pct <= 0 {
+		return s.ranges[0].rawMin
+	}
+	if pct >= 100 {
+		return s.ranges[len(s.ranges)-1].rawMax
+	}
+	if max-min <= maxLinearDB {
+		return s.FromDB(min + int64(pct)*(max-min)/100)
+	}
+	norm := float64(pct) / 100
+	if !s.ranges[0].mute {
+		minNorm := math.Pow(10, float64(min-max)/6000)
+		norm = norm*(1-minNorm) + minNorm
+	}
+	db := int64(math.Round(6000*math.Log10(norm))) + max
+	return s.FromDB(db)
+}
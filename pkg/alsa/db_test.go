@@ -0,0 +1,176 @@
+package alsa
+
+import (
+	"reflect"
+	"testing"
+)
+
+// db returns a dB level, in hundredths, as a TLV word.
+func db(v int32) uint32 { return uint32(v) }
+
+// TLVs read from real cards.
+var (
+	// hifiberryTLV is the "Digital" control of a HiFiBerry DAC+, raw values
+	// 0..207: -103.5 dB in 0.5 dB steps, where 0 is muted.
+	hifiberryTLV = []uint32{tlvDBScale, 8, db(-10350), 0x10000 | 50}
+	// bcm2835TLV is the "PCM" control of a Raspberry Pi's headphone jack,
+	// raw values -10239..400: -102.39 dB in 0.01 dB steps, where the lowest
+	// is muted.
+	bcm2835TLV = []uint32{tlvDBScale, 8, db(-10239), 0x10000 | 1}
+	// usbTLV is the "PCM" control of a USB sound card, raw values 0..255.
+	usbTLV = []uint32{tlvDBMinMax, 8, db(-5100), 0}
+	// rangeTLV is a codec's headphone control, raw values 0..7, with coarse
+	// steps at the bottom of its range.
+	rangeTLV = []uint32{
+		tlvDBRange, 48,
+		0, 1, tlvDBScale, 8, db(-7200), 1200,
+		2, 7, tlvDBScale, 8, db(-5400), 600,
+	}
+)
+
+func TestParseDBScale(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		tlv      []uint32
+		min, max int64
+		want     []dbRange
+	}{
+		{"DB_SCALE with mute", hifiberryTLV, 0, 207, []dbRange{{0, 207, -10350, 0, true}}},
+		{"DB_SCALE from a negative value", bcm2835TLV, -10239, 400, []dbRange{{-10239, 400, -10239, 400, true}}},
+		{"DB_MINMAX", usbTLV, 0, 255, []dbRange{{0, 255, -5100, 0, false}}},
+		{"DB_MINMAX_MUTE", []uint32{tlvDBMinMaxMut, 8, db(-5100), 0}, 0, 255, []dbRange{{0, 255, -5100, 0, true}}},
+		{"DB_RANGE", rangeTLV, 0, 7, []dbRange{{0, 1, -7200, -6000, false}, {2, 7, -5400, -2400, false}}},
+		{"container", []uint32{tlvContainer, 16, tlvDBScale, 8, db(-10350), 0x10000 | 50}, 0, 207, []dbRange{{0, 207, -10350, 0, true}}},
+		{
+			"container with a linear TLV first",
+			[]uint32{tlvContainer, 32, tlvDBLinear, 8, db(-5000), 0, tlvDBMinMax, 8, db(-5100), 0},
+			0, 255,
+			[]dbRange{{0, 255, -5100, 0, false}},
+		},
+		{"DB_LINEAR", []uint32{tlvDBLinear, 8, db(-5000), 0}, 0, 255, nil},
+		{"truncated", []uint32{tlvDBScale, 8, db(-10350)}, 0, 207, nil},
+		{"short", []uint32{tlvDBScale, 4, db(-10350)}, 0, 207, nil},
+		{"empty", nil, 0, 207, nil},
+		{"unknown type", []uint32{99, 8, 0, 0}, 0, 207, nil},
+	} {
+		s := parseDBScale(c.tlv, c.min, c.max)
+		if c.want == nil {
+			if s != nil {
+				t.Errorf("%s: parsed %+v, want no scale", c.name, s.ranges)
+			}
+			continue
+		}
+		if s == nil {
+			t.Errorf("%s: no scale, want %+v", c.name, c.want)
+			continue
+		}
+		if !reflect.DeepEqual(s.ranges, c.want) {
+			t.Errorf("%s: parsed %+v, want %+v", c.name, s.ranges, c.want)
+		}
+	}
+}
+
+func TestDBConversions(t *testing.T) {
+	hifiberry := parseDBScale(hifiberryTLV, 0, 207)
+	ranged := parseDBScale(rangeTLV, 0, 7)
+	for _, c := range []struct {
+		name   string
+		s      *DBScale
+		raw    int64
+		db     int64
+		fromDB int64
+	}{
+		{"min", hifiberry, 0, -10350, -10350},
+		{"max", hifiberry, 207, 0, 0},
+		{"middle", hifiberry, 107, -5000, -5000},
+		{"range bottom", ranged, 0, -7200, -7200},
+		{"range top of first", ranged, 1, -6000, -6000},
+		{"range bottom of second", ranged, 2, -5400, -5400},
+		{"range middle of second", ranged, 5, -3600, -3600},
+		{"range max", ranged, 7, -2400, -2400},
+	} {
+		if got := c.s.ToDB(c.raw); got != c.db {
+			t.Errorf("%s: ToDB(%d) = %d, want %d", c.name, c.raw, got, c.db)
+		}
+		if got := c.s.FromDB(c.fromDB); got != c.raw {
+			t.Errorf("%s: FromDB(%d) = %d, want %d", c.name, c.fromDB, got, c.raw)
+		}
+	}
+
+	// Levels out of range are clamped, and levels between ranges go to the
+	// bottom of the next one.
+	for _, c := range []struct {
+		s       *DBScale
+		db, raw int64
+	}{
+		{hifiberry, -20000, 0},
+		{hifiberry, 600, 207},
+		{ranged, -5700, 2},
+		{ranged, -100, 7},
+	} {
+		if got := c.s.FromDB(c.db); got != c.raw {
+			t.Errorf("FromDB(%d) = %d, want %d", c.db, got, c.raw)
+		}
+	}
+	if got := hifiberry.ToDB(300); got != 0 {
+		t.Errorf("ToDB above max = %d, want 0", got)
+	}
+	if min, max := ranged.Range(); min != -7200 || max != -2400 {
+		t.Errorf("Range = %d, %d, want -7200, -2400", min, max)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	hifiberry := parseDBScale(hifiberryTLV, 0, 207)
+	bcm2835 := parseDBScale(bcm2835TLV, -10239, 400)
+	usb := parseDBScale(usbTLV, 0, 255)
+	usbMute := parseDBScale([]uint32{tlvDBMinMaxMut, 8, db(-5100), 0}, 0, 255)
+	// A range narrow enough to be mapped linearly.
+	narrow := parseDBScale([]uint32{tlvDBMinMax, 8, db(-2400), 0}, 0, 48)
+	for _, c := range []struct {
+		name string
+		s    *DBScale
+		raw  int64
+		pct  int
+	}{
+		{"muted min", hifiberry, 0, 0},
+		{"max", hifiberry, 207, 100},
+		// -18 dB sounds about half as loud.
+		{"half", hifiberry, 171, 50},
+		{"negative raw min", bcm2835, -10239, 0},
+		{"negative raw max", bcm2835, 400, 100},
+		{"0 dB below a positive max", bcm2835, 7, 86},
+		{"unmuted min", usb, 0, 0},
+		{"unmuted max", usb, 255, 100},
+		{"narrow", narrow, 24, 50},
+		{"narrow min", narrow, 0, 0},
+		{"narrow max", narrow, 48, 100},
+	} {
+		if got := c.s.Percent(c.raw); got != c.pct {
+			t.Errorf("%s: Percent(%d) = %d, want %d", c.name, c.raw, got, c.pct)
+		}
+		if got := c.s.FromPercent(c.pct); got != c.raw {
+			t.Errorf("%s: FromPercent(%d) = %d, want %d", c.name, c.pct, got, c.raw)
+		}
+	}
+
+	// Without a mute, the curve is stretched so that 0% is the lowest
+	// level, which puts the middle of the raw range lower.
+	if got := usb.Percent(128); got != 27 {
+		t.Errorf("Percent(128) without mute = %d, want 27", got)
+	}
+	if got := usbMute.Percent(128); got != 38 {
+		t.Errorf("Percent(128) with mute = %d, want 38", got)
+	}
+
+	for _, s := range []*DBScale{hifiberry, bcm2835, usb, usbMute, narrow} {
+		last := s.FromPercent(-5)
+		for pct := 0; pct <= 105; pct++ {
+			raw := s.FromPercent(pct)
+			if raw < last {
+				t.Errorf("FromPercent(%d) = %d, below FromPercent(%d) = %d", pct, raw, pct-1, last)
+			}
+			last = raw
+		}
+	}
+}
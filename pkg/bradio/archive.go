@@ -0,0 +1,184 @@
+package bradio
+
+import (
+	"log"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// archiveLines is the number of episodes shown at once in the archive list.
+const archiveLines = 5
+
+// archiveList is the list of a station's archived episodes shown on the
+// screen, and the one selected.
+type archiveList struct {
+	eps []station.Episode
+	idx int
+}
+
+func (al *archiveList) move(delta int) {
+	al.idx += delta
+	if al.idx < 0 {
+		al.idx = 0
+	}
+	if al.idx >= len(al.eps) {
+		al.idx = len(al.eps) - 1
+	}
+}
+
+// openArchive shows the list of the current station's archived episodes.
+func (br *BossRadio) openArchive() error {
+	stn := br.stns[br.stnIdx]
+	msg := "No archive"
+	if a, ok := stn.(station.Archiver); ok {
+		eps, err := a.Episodes()
+		if err != nil {
+			log.Printf("Episodes failed: %v", err)
+			msg = "Archive failed"
+		} else if len(eps) == 0 {
+			msg = "No episodes"
+		} else {
+			br.archive = &archiveList{eps: eps}
+			return nil
+		}
+	}
+	br.flashArchive(msg)
+	return nil
+}
+
+// flashArchive shows msg about the current station's archive.
+func (br *BossRadio) flashArchive(msg string) {
+	br.scrn.ClearText()
+	br.scrn.SetTextLine(2, msg)
+	br.scrn.SetTextLine(3, br.stns[br.stnIdx].Name())
+	br.scrn.Draw()
+	br.scrn.Freeze(500 * time.Millisecond)
+}
+
+// archiveEvent handles an event while the archive list is open. Up and down
+// move through the list, the center button or right plays the episode
+// selected, and left closes the list. It returns false for events that the
+// list leaves alone, like the volume dial.
+func (br *BossRadio) archiveEvent(ev events.Event) (bool, error) {
+	al := br.archive
+	switch ev.Key {
+	case events.ButtonUp, events.RemoteUp:
+		if ev.Gesture == events.Press || ev.Gesture == events.Repeat {
+			al.move(-1)
+		}
+	case events.ButtonDown, events.RemoteDown:
+		if ev.Gesture == events.Press || ev.Gesture == events.Repeat {
+			al.move(1)
+		}
+	case events.DialTune:
+		switch ev.Gesture {
+		case events.Turn:
+			al.move(ev.Delta)
+		case events.Release:
+			return true, br.startEpisode(al.eps[al.idx])
+		}
+	case events.ButtonCenter:
+		if ev.Gesture == events.Release {
+			return true, br.startEpisode(al.eps[al.idx])
+		}
+	case events.RemotePlay, events.ButtonRight, events.RemoteRight:
+		if ev.Gesture == events.Press {
+			return true, br.startEpisode(al.eps[al.idx])
+		}
+	case events.ButtonLeft, events.RemoteLeft, events.RemoteMenu, events.Archive:
+		if ev.Gesture == events.Press {
+			br.archive = nil
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// playEpisode plays the current station's archived episode with the given
+// ID, or if id is empty, the i'th one. The request comes from the network,
+// so failures are only shown.
+func (br *BossRadio) playEpisode(id string, i int) error {
+	stn := br.stns[br.stnIdx]
+	a, ok := stn.(station.Archiver)
+	if !ok {
+		br.flashArchive("No archive")
+		return nil
+	}
+	eps, err := a.Episodes()
+	if err != nil {
+		log.Printf("Episodes failed: %v", err)
+		br.flashArchive("Archive failed")
+		return nil
+	}
+	if id != "" {
+		i = -1
+		for j, ep := range eps {
+			if ep.ID == id {
+				i = j
+				break
+			}
+		}
+	}
+	if i < 0 || i >= len(eps) {
+		log.Printf("no episode %q (%d) of %s", id, i, stn.Name())
+		br.flashArchive("No episode")
+		return nil
+	}
+	return br.startEpisode(eps[i])
+}
+
+// startEpisode plays an archived episode of the current station, and closes
+// the archive list.
+func (br *BossRadio) startEpisode(ep station.Episode) error {
+	br.archive = nil
+	stn := br.stns[br.stnIdx]
+	s, err := stn.(station.Archiver).EpisodeStream(ep)
+	if err != nil {
+		log.Printf("EpisodeStream failed: %v", err)
+		br.flashArchive("Archive failed")
+		return nil
+	}
+	br.stop()
+	br.archived = &ep
+	if err := br.startPlayer(s); err != nil {
+		br.archived = nil
+		log.Printf("playing %s failed: %v", ep.Title, err)
+		br.flashArchive("Archive failed")
+		return nil
+	}
+	br.playing = stn
+	if err := br.vol.setStation(stn.Name()); err != nil {
+		return err
+	}
+	br.updateStatus()
+	return nil
+}
+
+func (br *BossRadio) showArchive() {
+	al := br.archive
+	first := al.idx - archiveLines/2
+	if first > len(al.eps)-archiveLines {
+		first = len(al.eps) - archiveLines
+	}
+	if first < 0 {
+		first = 0
+	}
+	lines := [6]string{"   Archive"}
+	for i := 0; i < archiveLines && first+i < len(al.eps); i++ {
+		ep := al.eps[first+i]
+		line := " "
+		if first+i == al.idx {
+			line = ">"
+		}
+		if !ep.Aired.IsZero() {
+			line += ep.Aired.Local().Format("01/02") + " "
+		}
+		lines[1+i] = line + ep.Show
+	}
+	br.scrn.SetText(lines)
+	br.scrn.SetProgress(-1)
+	br.scrn.Draw()
+}
@@ -1,20 +1,27 @@
 package bradio
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/itchyny/volume-go"
-
-	"github.com/nlacasse/boss-radio/pkg/button"
+	"github.com/nlacasse/boss-radio/pkg/config"
 	"github.com/nlacasse/boss-radio/pkg/events"
-	"github.com/nlacasse/boss-radio/pkg/remote"
+	"github.com/nlacasse/boss-radio/pkg/health"
+	"github.com/nlacasse/boss-radio/pkg/history"
+	"github.com/nlacasse/boss-radio/pkg/input"
+	"github.com/nlacasse/boss-radio/pkg/player"
+	"github.com/nlacasse/boss-radio/pkg/radiobrowser"
+	"github.com/nlacasse/boss-radio/pkg/recorder"
 	"github.com/nlacasse/boss-radio/pkg/screen"
 	"github.com/nlacasse/boss-radio/pkg/station"
+	"github.com/nlacasse/boss-radio/pkg/timeshift"
 	"github.com/nlacasse/boss-radio/pkg/web"
 )
 
@@ -27,6 +34,28 @@ const (
 
 type dialTurn int
 
+const (
+	// volumeStep is how much a single press changes the volume by.
+	volumeStep = 5
+	// maxVolumeMult caps how much holding a volume key speeds it up.
+	maxVolumeMult = 4
+	// rewindStep and rewindFar are how far the Rewind key goes back.
+	rewindStep = 30 * time.Second
+	rewindFar  = 5 * time.Minute
+	// minBehind is how far behind live the stream must be before it is
+	// shown, to hide the slack in working out the position.
+	minBehind = 5 * time.Second
+	// fastDial is the speed, in detents per second, at which each detent of
+	// the volume dial starts to count double.
+	fastDial = 8
+	// rebufferLimit is how many rebuffers in the last hour make a station
+	// prefer its lower bitrate streams.
+	rebufferLimit = 3
+	// skipHoldRepeats is the number of IR repeats after which holding left
+	// or right on a station with tracks changes station instead.
+	skipHoldRepeats = 5
+)
+
 var (
 	dialTurnLeft  dialTurn = -1
 	dialTurnRight dialTurn = 1
@@ -34,40 +63,172 @@ var (
 
 type BossRadio struct {
 	// immutable
-	btn    *button.Button
-	remote *remote.Remote
-	web    *web.Web
-	scrn   *screen.Screen
+	srcs  []input.Source
+	web   *web.Web
+	scrn  *screen.Screen
+	sched *scheduler
+	hist  *history.Store
+	bkmks *history.Store
+	// volAccel is the number of IR repeats per volume speedup.
+	volAccel int
+	stnCfgs  map[string]config.Station
+	// cfg is kept to save the stations added from the web UI.
+	cfg *config.Config
+	// health checks the stations, if it is not nil, and skipUnhealthy
+	// skips the ones failing when turning the dial.
+	health        *health.Checker
+	skipUnhealthy bool
+	// timeShift is the length of the time-shift buffer, 0 for none, and
+	// shiftBitrate the bitrate it is sized for.
+	timeShift    time.Duration
+	shiftBitrate int
+	shiftPath    string
+	recDir       string
+	// showLoudness measures the loudness of every station.
+	showLoudness bool
+	// outputs are the audio devices that can be switched between. The
+	// first is the configured default.
+	outputs []config.Output
 
-	state     state
-	cmd       *exec.Cmd
+	state  state
+	player player.Player
+	paused bool
+	vol    *volumeManager
+	outIdx int
+	shift  *timeshift.Shifter
+	// playing is the station the player was started for.
+	playing station.Station
+	// sources are the URLs the live stream can be played from, in the
+	// order they are tried, and srcIdx the one playing.
+	sources []player.Source
+	srcIdx  int
+	// archived is the archived episode playing, or nil for the live
+	// stream, and archive is the list of episodes while it is open.
+	archived *station.Episode
+	archive  *archiveList
+	// recs are the recordings in progress, by station name.
+	recs      map[string]*recorder.Recorder
 	stns      []station.Station
 	stnIdx    int
 	curStatus station.Status
+	lastEntry history.Entry
 }
 
-func NewBossRadio(stns []station.Station) (*BossRadio, error) {
+func NewBossRadio(cfg *config.Config, stns []station.Station) (*BossRadio, error) {
+	sched, err := newScheduler(cfg.Schedule, stns, realClock{})
+	if err != nil {
+		return nil, fmt.Errorf("bad schedule: %v", err)
+	}
+
+	hist, err := history.Open(cfg.DataPath("history.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("history.Open failed: %v", err)
+	}
+
+	bkmks, err := history.Open(cfg.DataPath("bookmarks.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("history.Open failed: %v", err)
+	}
+
+	srcs, err := input.FromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	gains := make(map[string]int)
+	for name, sc := range cfg.Stations {
+		gains[name] = sc.Gain
+	}
+	backend, err := newVolumeBackend(cfg.Volume)
+	if err != nil {
+		return nil, err
+	}
+	vol := newVolumeManager(backend, cfg.Volume.Min, cfg.Volume.Max, gains)
+	if err := vol.init(cfg.Volume.Startup); err != nil {
+		return nil, fmt.Errorf("setting startup volume failed: %v", err)
+	}
+
+	recDir := cfg.RecordDir
+	if recDir == "" {
+		recDir = cfg.DataPath("recordings")
+	}
+
 	scrn, err := screen.New()
 	if err != nil {
 		return nil, fmt.Errorf("screen.New failed: %v", err)
 	}
 
+	var checker *health.Checker
+	if cfg.HealthCheck > 0 {
+		checker = health.NewChecker(stns, time.Duration(cfg.HealthCheck))
+	}
+
+	w := web.New(web.Options{
+		History:   hist,
+		Bookmarks: bkmks,
+		RecordDir: recDir,
+		Stations:  stns,
+		Directory: radiobrowser.New(cfg.Directory),
+	})
+
 	return &BossRadio{
-		btn:    button.New(),
-		remote: remote.New(),
-		web:    web.New(),
-		scrn:   scrn,
-		state:  stateOff,
-		stns:   stns,
+		srcs:          srcs,
+		vol:           vol,
+		web:           w,
+		scrn:          scrn,
+		sched:         sched,
+		hist:          hist,
+		bkmks:         bkmks,
+		volAccel:      cfg.VolumeAccel,
+		stnCfgs:       cfg.Stations,
+		cfg:           cfg,
+		health:        checker,
+		skipUnhealthy: cfg.SkipUnhealthy,
+		timeShift:     time.Duration(cfg.TimeShift),
+		shiftBitrate:  cfg.TimeShiftBitrate,
+		shiftPath:     cfg.DataPath("timeshift.buf"),
+		recDir:        recDir,
+		showLoudness:  cfg.ShowLoudness,
+		recs:          make(map[string]*recorder.Recorder),
+		outputs:       append([]config.Output{{Name: "Default", Device: cfg.AudioDevice}}, cfg.Outputs...),
+		state:         stateOff,
+		stns:          stns,
 	}, nil
 
 }
 
 func (br *BossRadio) turnDial(dt dialTurn) error {
-	br.stnIdx = (br.stnIdx + int(dt)) % len(br.stns)
-	if br.stnIdx < 0 {
-		br.stnIdx += len(br.stns)
+	idx := br.dialIndex(br.stnIdx, int(dt))
+	if br.skipUnhealthy && dt != 0 {
+		// Keep going in the same direction past unhealthy stations, unless
+		// they all are.
+		step := 1
+		if dt < 0 {
+			step = -1
+		}
+		for i := idx; i != br.stnIdx; i = br.dialIndex(i, step) {
+			if br.healthy(br.stns[i]) {
+				idx = i
+				break
+			}
+		}
+	}
+	return br.tune(idx)
+}
+
+// dialIndex returns the index of the station delta stations from i, wrapping
+// around the ends.
+func (br *BossRadio) dialIndex(i, delta int) int {
+	i = (i + delta) % len(br.stns)
+	if i < 0 {
+		i += len(br.stns)
 	}
+	return i
+}
+
+// tune plays the i'th station.
+func (br *BossRadio) tune(i int) error {
+	br.stnIdx = i
 	if err := br.play(); err != nil {
 		return err
 	}
@@ -75,20 +236,122 @@ func (br *BossRadio) turnDial(dt dialTurn) error {
 	return nil
 }
 
+// healthy reports whether stn passed its last health check. Stations are
+// healthy until checked.
+func (br *BossRadio) healthy(stn station.Station) bool {
+	return br.health == nil || br.health.Result(stn.Name()).OK()
+}
+
+// leftRight handles the left and right keys. They skip tracks on stations
+// that have them, where holding the key changes station instead.
+func (br *BossRadio) leftRight(ev events.Event, dt dialTurn) error {
+	pl, ok := br.player.(player.Playlister)
+	if _, skipper := br.stns[br.stnIdx].(station.Skipper); !skipper || !ok {
+		if ev.Gesture == events.Press {
+			return br.turnDial(dt)
+		}
+		return nil
+	}
+
+	switch {
+	case ev.Gesture == events.Press:
+		skip := pl.Next
+		if dt == dialTurnLeft {
+			skip = pl.Prev
+		}
+		if err := skip(); err != nil {
+			return err
+		}
+		br.updateStatus()
+	case ev.Gesture == events.LongPress,
+		ev.Gesture == events.Repeat && ev.Count == skipHoldRepeats:
+		return br.turnDial(dt)
+	}
+	return nil
+}
+
 func (br *BossRadio) turnVolume(delta int) error {
-	if err := volume.IncreaseVolume(delta); err != nil {
+	if err := br.vol.change(delta); err != nil {
 		return err
 	}
+	br.flashVolume()
+	return nil
+}
 
-	// Flash new volume.
-	vol, err := volume.GetVolume()
-	if err != nil {
+func (br *BossRadio) setVolume(level int) error {
+	if err := br.vol.set(level); err != nil {
 		return err
 	}
+	br.flashVolume()
+	return nil
+}
+
+func (br *BossRadio) flashVolume() {
 	br.scrn.ClearText()
-	br.scrn.SetTextLine(2, fmt.Sprintf("Volume: %d", vol))
+	br.scrn.SetTextLine(2, fmt.Sprintf("Volume: %d", br.vol.level))
+	if br.vol.gain != 0 {
+		br.scrn.SetTextLine(3, fmt.Sprintf("Station: %+d", br.vol.gain))
+	}
 	br.scrn.Draw()
 	br.scrn.Freeze(250 * time.Millisecond)
+}
+
+// setOutput switches to output i, restarting the stream on it.
+func (br *BossRadio) setOutput(i int) error {
+	if i < 0 || i >= len(br.outputs) {
+		return fmt.Errorf("no output %d", i)
+	}
+	br.outIdx = i
+	out := br.outputs[i]
+	log.Printf("switching output to %s (%q)", out.Name, out.Device)
+	if br.shift != nil {
+		// Carry on from the same place in the buffer.
+		br.shift.Pause()
+		br.shift.Resume()
+		if err := br.startPlayer(br.shift.Stream()); err != nil {
+			return err
+		}
+	} else if err := br.play(); err != nil {
+		return err
+	}
+	br.scrn.ClearText()
+	br.scrn.SetTextLine(2, "Output:")
+	br.scrn.SetTextLine(3, out.Name)
+	br.scrn.Draw()
+	br.scrn.Freeze(500 * time.Millisecond)
+	return nil
+}
+
+func (br *BossRadio) toggleMute() error {
+	return br.vol.toggleMute()
+}
+
+// togglePause pauses or resumes the stream, if the station supports it.
+func (br *BossRadio) togglePause() error {
+	if br.player == nil {
+		return nil
+	}
+	if br.shift != nil {
+		// Note the position before it stops moving.
+		if br.paused {
+			defer br.shift.Resume()
+		} else {
+			br.shift.Pause()
+		}
+	}
+	err := br.player.SetPaused(!br.paused)
+	if errors.Is(err, player.ErrNotSupported) {
+		br.scrn.ClearText()
+		br.scrn.SetTextLine(2, "Can't pause")
+		br.scrn.SetTextLine(3, br.stns[br.stnIdx].Name())
+		br.scrn.Draw()
+		br.scrn.Freeze(500 * time.Millisecond)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	br.paused = !br.paused
 	return nil
 }
 
@@ -96,8 +359,8 @@ func (br *BossRadio) power() error {
 	if br.state == stateOn {
 		// Turning off.
 		br.state = stateOff
-		br.cmd.Process.Kill()
-		br.cmd = nil
+		br.archive = nil
+		br.stop()
 		return nil
 	}
 
@@ -110,6 +373,33 @@ func (br *BossRadio) power() error {
 	return nil
 }
 
+func (br *BossRadio) handleAction(a action) error {
+	switch a.kind {
+	case actionRecord:
+		// Recording does not need the radio to be on.
+		return br.startRecording(br.stns[a.stnIdx], a.dur)
+	case actionPowerOff:
+		if br.isOff() {
+			return nil
+		}
+		return br.power()
+	case actionPowerOn, actionTune:
+		if a.stnIdx >= 0 {
+			br.stnIdx = a.stnIdx
+		}
+		if br.isOff() {
+			return br.power()
+		}
+		if a.kind == actionPowerOn && a.stnIdx < 0 {
+			// Already on.
+			return nil
+		}
+		return br.turnDial(0)
+	default:
+		return fmt.Errorf("unknown action: %v", a.kind)
+	}
+}
+
 func (br *BossRadio) isOff() bool {
 	return br.state == stateOff
 }
@@ -118,22 +408,41 @@ func (br *BossRadio) Run() error {
 	eventCh := make(chan events.Event)
 	webEventCh := make(chan events.Event)
 	webStatusCh := make(chan web.Status)
-	if err := br.btn.Listen(eventCh); err != nil {
-		return fmt.Errorf("Button.Listen failed: %w", err)
-	}
-	if err := br.remote.Listen(eventCh); err != nil {
-		return fmt.Errorf("Remote.Listen failed: %w", err)
+	addCh := make(chan radiobrowser.Station)
+	schedCh := make(chan action)
+	schedDone := make(chan struct{})
+	defer close(schedDone)
+	go br.sched.run(schedCh, schedDone)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, src := range br.srcs {
+		if err := src.Start(ctx, eventCh); err != nil {
+			return fmt.Errorf("%T.Start failed: %w", src, err)
+		}
 	}
-	if err := br.web.ListenAndUpdate(webEventCh, webStatusCh); err != nil {
+	// The web UI checks requests against the status, so it needs one from
+	// the start.
+	br.web.Update(br.webStatus())
+	if err := br.web.ListenAndUpdate(webEventCh, webStatusCh, addCh); err != nil {
 		return fmt.Errorf("Web.Listen failed: %w", err)
 	}
+	if br.health != nil {
+		go br.health.Run(ctx)
+	}
 	defer br.stop()
 
 	br.updateDisplay()
+	br.updateSchedule()
 
 	// Tick every 30 seconds to update the status screen or clock.
 	statusUpdateTicker := time.NewTicker(30 * time.Second)
 	defer statusUpdateTicker.Stop()
+	// Tick every second to count the time behind live.
+	shiftTicker := time.NewTicker(time.Second)
+	defer shiftTicker.Stop()
+	// Tick every 5 seconds to check that the stream is still playing.
+	watchTicker := time.NewTicker(5 * time.Second)
+	defer watchTicker.Stop()
 
 	for {
 		select {
@@ -148,29 +457,36 @@ func (br *BossRadio) Run() error {
 			if err := br.handleEvent(ev); err != nil {
 				return err
 			}
-			if br.state == stateOff {
-				webStatusCh <- web.Status{}
-			} else {
-				stn := br.stns[br.stnIdx]
-				webStatusCh <- web.Status{
-					Power:  true,
-					Name:   stn.Name(),
-					Status: br.curStatus,
-				}
+			webStatusCh <- br.webStatus()
+
+		case rs := <-addCh:
+			if err := br.addStation(rs); err != nil {
+				log.Printf("adding %s failed: %v", rs.Name, err)
+			}
+
+		case a := <-schedCh:
+			log.Printf("got scheduled action %v", a.describe(br.stns))
+			if err := br.handleAction(a); err != nil {
+				return err
+			}
+			br.updateSchedule()
+
+		case <-shiftTicker.C:
+			if br.behind() == "" {
+				continue
+			}
+
+		case <-watchTicker.C:
+			if err := br.watchPlayer(); err != nil {
+				log.Printf("watchPlayer failed: %v", err)
 			}
+			continue
 
 		case <-statusUpdateTicker.C:
-			st := web.Status{}
 			if br.state == stateOn {
 				br.updateStatus()
-				stn := br.stns[br.stnIdx]
-				st = web.Status{
-					Power:  true,
-					Name:   stn.Name(),
-					Status: br.curStatus,
-				}
 			}
-			br.web.Update(st)
+			br.web.Update(br.webStatus())
 		}
 
 		br.updateDisplay()
@@ -178,8 +494,18 @@ func (br *BossRadio) Run() error {
 }
 
 func (br *BossRadio) handleEvent(ev events.Event) error {
-	// Always handle power button (middle/play).
-	if ev == events.ButtonCenter || ev == events.RemotePlay {
+	// The archive list takes the keys it needs while it is open.
+	if br.archive != nil {
+		if handled, err := br.archiveEvent(ev); handled {
+			return err
+		}
+	}
+
+	// Always handle power button (middle/play/tuning dial). The middle button
+	// acts on release so that it can also be long-pressed.
+	if ev == (events.Event{Key: events.ButtonCenter, Gesture: events.Release}) ||
+		ev == (events.Event{Key: events.RemotePlay, Gesture: events.Press}) ||
+		ev == (events.Event{Key: events.DialTune, Gesture: events.Release}) {
 		return br.power()
 	}
 
@@ -189,30 +515,253 @@ func (br *BossRadio) handleEvent(ev events.Event) error {
 	}
 
 	// Handle other events.
-	switch ev {
+	switch ev.Key {
 	case events.ButtonLeft, events.RemoteLeft:
-		return br.turnDial(dialTurnLeft)
+		return br.leftRight(ev, dialTurnLeft)
 	case events.ButtonRight, events.RemoteRight:
-		return br.turnDial(dialTurnRight)
+		return br.leftRight(ev, dialTurnRight)
 	case events.ButtonUp, events.RemoteUp:
-		return br.turnVolume(5)
+		if step := br.volumeStep(ev); step > 0 {
+			return br.turnVolume(step)
+		}
 	case events.ButtonDown, events.RemoteDown:
-		return br.turnVolume(-5)
+		if ev == (events.Event{Key: events.ButtonDown, Gesture: events.LongPress}) {
+			// Holding volume down mutes.
+			return br.toggleMute()
+		}
+		if step := br.volumeStep(ev); step > 0 {
+			return br.turnVolume(-step)
+		}
+	case events.Mute:
+		if ev.Gesture == events.Press {
+			return br.toggleMute()
+		}
+	case events.Pause:
+		if ev.Gesture == events.Press {
+			return br.togglePause()
+		}
+	case events.Volume:
+		if ev.Gesture == events.Set {
+			return br.setVolume(ev.Level)
+		}
+	case events.Rewind:
+		switch ev.Gesture {
+		case events.Press:
+			return br.seek(-rewindStep)
+		case events.LongPress:
+			return br.seek(-rewindFar)
+		case events.Set:
+			return br.seek(-time.Duration(ev.Level) * time.Second)
+		}
+	case events.Seek:
+		if ev.Gesture == events.Set {
+			return br.seek(time.Duration(ev.Level) * time.Second)
+		}
+	case events.Tune:
+		if ev.Gesture == events.Set && ev.Level >= 0 && ev.Level < len(br.stns) {
+			return br.tune(ev.Level)
+		}
+	case events.Archive:
+		switch ev.Gesture {
+		case events.Press:
+			return br.openArchive()
+		case events.Set:
+			return br.playEpisode(ev.ID, ev.Level)
+		}
+	case events.Live:
+		if ev.Gesture == events.Press {
+			return br.goLive()
+		}
+	case events.Record:
+		if ev.Gesture == events.Press {
+			return br.toggleRecord()
+		}
+	case events.Output:
+		switch ev.Gesture {
+		case events.Press:
+			return br.setOutput((br.outIdx + 1) % len(br.outputs))
+		case events.Set:
+			if ev.Level < 0 || ev.Level >= len(br.outputs) {
+				// Events from the network can ask for anything.
+				log.Printf("no output %d", ev.Level)
+				br.scrn.ClearText()
+				br.scrn.SetTextLine(2, "No output")
+				br.scrn.SetTextLine(3, strconv.Itoa(ev.Level))
+				br.scrn.Draw()
+				br.scrn.Freeze(500 * time.Millisecond)
+				return nil
+			}
+			return br.setOutput(ev.Level)
+		}
+	case events.ButtonCenter:
+		if ev.Gesture == events.LongPress {
+			return br.bookmark()
+		}
 	case events.RemoteMenu:
-		// Noop for now.
-		return nil
-	case events.ButtonCenter, events.RemotePlay:
+		if ev.Gesture == events.Press {
+			return br.bookmark()
+		}
+	case events.DialTune:
+		if ev.Gesture == events.Turn {
+			return br.turnDial(dialTurn(ev.Delta))
+		}
+	case events.DialVolume:
+		if ev.Gesture == events.Press {
+			return br.toggleMute()
+		}
+		if ev.Gesture == events.Turn {
+			mult := 1 + int(ev.Velocity/fastDial)
+			if mult > maxVolumeMult {
+				mult = maxVolumeMult
+			}
+			return br.turnVolume(ev.Delta * mult * volumeStep)
+		}
+	case events.RemotePlay:
 		// Already handled above.
-		return nil
 	default:
 		return fmt.Errorf("unknown event: %v", ev)
 	}
+	return nil
+}
+
+// volumeStep returns how much a volume key event should change the volume
+// by. Holding a remote key speeds up the change. It returns 0 for events
+// that should not change the volume.
+func (br *BossRadio) volumeStep(ev events.Event) int {
+	switch ev.Gesture {
+	case events.Press:
+		return volumeStep
+	case events.Repeat:
+		if br.volAccel <= 0 {
+			return volumeStep
+		}
+		mult := 1 + ev.Count/br.volAccel
+		if mult > maxVolumeMult {
+			mult = maxVolumeMult
+		}
+		return mult * volumeStep
+	default:
+		return 0
+	}
 }
 
 func (br *BossRadio) updateStatus() {
 	log.Printf("update status")
+	if ep := br.archived; ep != nil {
+		br.curStatus = station.Status{Show: ep.Show, Track: ep.Title}
+		if !ep.Aired.IsZero() {
+			br.curStatus.Album = "Aired " + ep.Aired.Local().Format("Jan 2 2006")
+		}
+		br.recordHistory()
+		return
+	}
 	stn := br.stns[br.stnIdx]
+	if s, ok := stn.(station.Skipper); ok {
+		if pl, ok := br.player.(player.Playlister); ok {
+			if pos, err := pl.Pos(); err == nil {
+				s.SetTrack(pos)
+			}
+		}
+	}
+	br.savePosition()
 	br.curStatus = stn.Status()
+	if t, ok := br.player.(player.Titler); ok && br.curStatus == (station.Status{}) {
+		// The station has no metadata of its own, so use the stream's.
+		br.curStatus.Track = t.StreamTitle()
+	}
+	br.recordHistory()
+}
+
+func (br *BossRadio) currentEntry() history.Entry {
+	return history.Entry{
+		Time:    time.Now(),
+		Station: br.stns[br.stnIdx].Name(),
+		Show:    br.curStatus.Show,
+		Artist:  br.curStatus.Artist,
+		Track:   br.curStatus.Track,
+		Album:   br.curStatus.Album,
+	}
+}
+
+// recordHistory appends the current status to the history if it changed.
+// Errors fetching the status are not history.
+func (br *BossRadio) recordHistory() {
+	if br.curStatus.Failed {
+		return
+	}
+	e := br.currentEntry()
+	if e.Empty() || e.SameAs(br.lastEntry) {
+		return
+	}
+	br.lastEntry = e
+	if err := br.hist.Append(e); err != nil {
+		log.Printf("history.Append failed: %v", err)
+	}
+}
+
+// bookmark saves the currently playing track to the bookmarks.
+func (br *BossRadio) bookmark() error {
+	e := br.currentEntry()
+	if err := br.bkmks.Append(e); err != nil {
+		return err
+	}
+	log.Printf("bookmarked %+v", e)
+
+	// Flash a heart.
+	br.scrn.DrawImage(screen.Heart())
+	br.scrn.Freeze(500 * time.Millisecond)
+	return nil
+}
+
+func (br *BossRadio) webStatus() web.Status {
+	if br.state == stateOff {
+		return web.Status{}
+	}
+	st := web.Status{
+		Power:  true,
+		Name:   br.stns[br.stnIdx].Name(),
+		Status: br.curStatus,
+		Muted:  br.vol.muted,
+		Volume: br.vol.level,
+		Paused: br.paused,
+		Output: br.outIdx,
+
+		TimeShift: br.shift != nil,
+		Archived:  br.archived != nil,
+		Behind:    br.behind(),
+		Recording: br.recording(br.stns[br.stnIdx].Name()),
+	}
+	for _, out := range br.outputs {
+		st.Outputs = append(st.Outputs, out.Name)
+	}
+	for _, stn := range br.stns {
+		si := web.StationInfo{Name: stn.Name()}
+		if br.health != nil {
+			si.Health = br.health.Result(stn.Name())
+			si.Rebuffers = br.health.Rebuffers(stn.Name())
+		}
+		st.Stations = append(st.Stations, si)
+	}
+	st.Station = br.stnIdx
+	if br.player != nil {
+		if lufs, err := br.player.Loudness(); err == nil {
+			st.LUFS = lufs
+			st.HasLUFS = true
+		}
+	}
+	return st
+}
+
+func (br *BossRadio) updateSchedule() {
+	var items []web.ScheduleItem
+	for _, sa := range br.sched.upcoming(br.sched.clock.Now(), 20) {
+		items = append(items, web.ScheduleItem{
+			Time:   sa.at,
+			Rule:   sa.rule.text,
+			Action: sa.rule.act.describe(br.stns),
+		})
+	}
+	br.web.UpdateSchedule(items)
 }
 
 func (br *BossRadio) updateDisplay() {
@@ -221,6 +770,10 @@ func (br *BossRadio) updateDisplay() {
 	case stateOff:
 		br.showClock()
 	case stateOn:
+		if br.archive != nil {
+			br.showArchive()
+			return
+		}
 		br.showStatus()
 	default:
 		panic(fmt.Sprintf("unknown state: %v", br.state))
@@ -235,14 +788,42 @@ func (br *BossRadio) showStatus() {
 	if namePad < 0 {
 		namePad = 0
 	}
-	br.scrn.SetText([6]string{
+	lines := [6]string{
 		strings.Repeat(" ", namePad) + stn.Name(),
 		"",
 		br.curStatus.Show,
 		br.curStatus.Artist,
 		br.curStatus.Track,
 		br.curStatus.Album,
-	})
+	}
+	if next := br.curStatus.Next; next != "" {
+		// Use the first free line, or the last line if all are taken.
+		i := 3
+		for i < 5 && lines[i] != "" {
+			i++
+		}
+		lines[i] = "Next: " + next
+	}
+	var flags []string
+	if br.vol.muted {
+		flags = append(flags, "MUTE")
+	}
+	if br.paused {
+		flags = append(flags, "PAUSED")
+	}
+	if br.recording(stn.Name()) {
+		flags = append(flags, "REC")
+	}
+	if b := br.behind(); b != "" {
+		flags = append(flags, "-"+b)
+	}
+	lines[1] = strings.Join(flags, " ")
+	br.scrn.SetText(lines)
+	if p, ok := br.curStatus.Progress(time.Now()); ok && len(flags) == 0 {
+		br.scrn.SetProgress(p)
+	} else {
+		br.scrn.SetProgress(-1)
+	}
 	br.scrn.Draw()
 }
 
@@ -260,8 +841,14 @@ func (br *BossRadio) showClock() {
 func (br *BossRadio) play() error {
 	stn := br.stns[br.stnIdx]
 	br.stop()
-	br.cmd = stn.StreamCmd()
-	if err := br.cmd.Start(); err != nil {
+	s := stn.Stream()
+	br.sources = br.orderSources(stn.Name(), s)
+	br.srcIdx = 0
+	if err := br.startStream(s); err != nil {
+		return err
+	}
+	br.playing = stn
+	if err := br.vol.setStation(stn.Name()); err != nil {
 		return err
 	}
 
@@ -271,17 +858,299 @@ func (br *BossRadio) play() error {
 	return nil
 }
 
+// orderSources returns the sources to try for a station's live stream. The
+// lowest bitrates go first if the player has kept running out of data.
+func (br *BossRadio) orderSources(name string, s player.Stream) []player.Source {
+	if !s.Live() {
+		return nil
+	}
+	if len(s.Sources) == 0 {
+		return []player.Source{{URL: s.URL}}
+	}
+	srcs := append([]player.Source(nil), s.Sources...)
+	if br.health == nil || br.health.Rebuffers(name) < rebufferLimit {
+		return srcs
+	}
+	log.Printf("%s keeps rebuffering, preferring lower bitrates", name)
+	sort.SliceStable(srcs, func(i, j int) bool {
+		// Unknown bitrates are likely high.
+		bi, bj := srcs[i].Bitrate, srcs[j].Bitrate
+		return bi != 0 && (bj == 0 || bi < bj)
+	})
+	return srcs
+}
+
+// startStream starts the player on s from the current source, through the
+// time-shift buffer if there is one.
+func (br *BossRadio) startStream(s player.Stream) error {
+	if len(br.sources) > 0 {
+		s.URL = br.sources[br.srcIdx].URL
+	}
+	if br.timeShift > 0 && s.Live() {
+		sh, err := timeshift.Start(s, br.shiftPath, br.timeShift, br.shiftBitrate)
+		if err != nil {
+			log.Printf("timeshift.Start failed: %v", err)
+		} else {
+			br.shift = sh
+			s = sh.Stream()
+		}
+	}
+	return br.startPlayer(s)
+}
+
+// watchPlayer checks that the live stream is still playing, and moves on to
+// its next source if it is not.
+func (br *BossRadio) watchPlayer() error {
+	if br.player == nil || br.paused || br.archived != nil || len(br.sources) == 0 {
+		return nil
+	}
+	m, ok := br.player.(player.Monitor)
+	if !ok {
+		return nil
+	}
+	err := m.Err()
+	if n := m.Rebuffers(); n > 0 && br.health != nil {
+		br.health.NoteRebuffers(br.playing.Name(), n)
+	}
+	if err == nil {
+		return nil
+	}
+	return br.failover(err)
+}
+
+// failover restarts the live stream from its next source.
+func (br *BossRadio) failover(cause error) error {
+	stn := br.playing
+	br.srcIdx = (br.srcIdx + 1) % len(br.sources)
+	log.Printf("%s failed: %v; trying %s", stn.Name(), cause, br.sources[br.srcIdx].URL)
+	// Close the buffer first, since the player may be stuck reading it.
+	if br.shift != nil {
+		br.shift.Close()
+		br.shift = nil
+	}
+	br.stopPlayer()
+	return br.startStream(stn.Stream())
+}
+
+// startPlayer (re)starts the player on s, for the current station and
+// output.
+func (br *BossRadio) startPlayer(s player.Stream) error {
+	br.stopPlayer()
+	stn := br.stns[br.stnIdx]
+	sc := br.stnCfgs[stn.Name()]
+	dev := sc.Device
+	if dev == "" {
+		dev = br.outputs[br.outIdx].Device
+	}
+	backend := sc.Player
+	if br.archived != nil {
+		// Archives may be on sites like Mixcloud, which only mpv plays.
+		backend = ""
+	}
+	br.player = player.New(s, player.Options{
+		Normalize: sc.Normalize,
+		Meter:     br.showLoudness,
+		Backend:   backend,
+		Device:    dev,
+	})
+	if err := br.player.Start(); err != nil {
+		br.player = nil
+		return err
+	}
+	return nil
+}
+
+func (br *BossRadio) stopPlayer() {
+	br.paused = false
+	if br.player == nil {
+		return
+	}
+	if err := br.player.Stop(); err != nil {
+		log.Printf("Player.Stop failed: %v", err)
+	}
+	br.player = nil
+}
+
 func (br *BossRadio) stop() {
-	if br.cmd == nil {
+	br.savePosition()
+	br.playing = nil
+	br.archived = nil
+	br.sources = nil
+	// Close the buffer first, since the player may be stuck reading it.
+	if br.shift != nil {
+		br.shift.Close()
+		br.shift = nil
+	}
+	br.stopPlayer()
+}
+
+// addStation adds a station from the directory, and saves it to the config.
+func (br *BossRadio) addStation(rs radiobrowser.Station) error {
+	for _, stn := range br.stns {
+		if stn.Name() == rs.Name {
+			return fmt.Errorf("there is already a station called %q", rs.Name)
+		}
+	}
+	stn := station.NewGeneric(rs.Name, rs.StreamURL(), nil)
+	br.stns = append(br.stns, stn)
+	if br.health != nil {
+		br.health.Add(stn)
+	}
+	br.cfg.Streams = append(br.cfg.Streams, config.Stream{Name: rs.Name, URL: rs.StreamURL()})
+	if err := br.cfg.Save(br.cfg.Path); err != nil {
+		return err
+	}
+	log.Printf("added station %s", rs.Name)
+
+	br.scrn.ClearText()
+	br.scrn.SetTextLine(2, "Added")
+	br.scrn.SetTextLine(3, rs.Name)
+	br.scrn.Draw()
+	br.scrn.Freeze(500 * time.Millisecond)
+	return nil
+}
+
+// savePosition tells the playing station how far through it the player is,
+// if it remembers that.
+func (br *BossRadio) savePosition() {
+	if br.archived != nil {
+		return
+	}
+	r, ok := br.playing.(station.Resumer)
+	if !ok {
 		return
 	}
-	br.cmd.Process.Kill()
-	br.cmd.Process.Release()
+	p, ok := br.player.(player.Positioner)
+	if !ok {
+		return
+	}
+	pos, length, err := p.Position()
+	if err != nil {
+		// The player exits once it gets to the end, having nothing more
+		// to play.
+		return
+	}
+	r.SetPosition(pos, length)
+}
+
+// recording returns whether the named station is being recorded.
+func (br *BossRadio) recording(name string) bool {
+	rec, ok := br.recs[name]
+	if !ok {
+		return false
+	}
+	select {
+	case <-rec.Done():
+		delete(br.recs, name)
+		return false
+	default:
+		return true
+	}
+}
+
+// startRecording starts recording stn for d, or until stopped if d is 0.
+func (br *BossRadio) startRecording(stn station.Station, d time.Duration) error {
+	if br.recording(stn.Name()) {
+		return nil
+	}
+	rec, err := recorder.Start(stn, br.recDir, d)
+	if err != nil {
+		// Not fatal: the station may not be recordable, or be down.
+		log.Printf("recording %s failed: %v", stn.Name(), err)
+		return nil
+	}
+	log.Printf("recording %s", stn.Name())
+	br.recs[stn.Name()] = rec
+	return nil
+}
+
+// toggleRecord starts or stops recording the current station.
+func (br *BossRadio) toggleRecord() error {
+	stn := br.stns[br.stnIdx]
+	msg := "Recording"
+	if br.recording(stn.Name()) {
+		br.recs[stn.Name()].Stop()
+		delete(br.recs, stn.Name())
+		msg = "Stopped rec"
+	} else {
+		if err := br.startRecording(stn, 0); err != nil {
+			return err
+		}
+		if !br.recording(stn.Name()) {
+			msg = "Can't record"
+		}
+	}
+	br.scrn.ClearText()
+	br.scrn.SetTextLine(2, msg)
+	br.scrn.SetTextLine(3, stn.Name())
+	br.scrn.Draw()
+	br.scrn.Freeze(500 * time.Millisecond)
+	return nil
+}
+
+// seek moves by d, back if negative, through the archived episode playing or
+// the time-shift buffer.
+func (br *BossRadio) seek(d time.Duration) error {
+	if s, ok := br.player.(player.Seeker); ok && br.archived != nil {
+		return s.Seek(d)
+	}
+	if br.shift == nil {
+		br.scrn.ClearText()
+		br.scrn.SetTextLine(2, "Can't seek")
+		br.scrn.SetTextLine(3, br.stns[br.stnIdx].Name())
+		br.scrn.Draw()
+		br.scrn.Freeze(500 * time.Millisecond)
+		return nil
+	}
+	br.shift.Seek(d)
+	return br.startPlayer(br.shift.Stream())
+}
+
+// goLive jumps to the live edge of the time-shift buffer, or back to the
+// live stream from an archived episode.
+func (br *BossRadio) goLive() error {
+	if br.archived != nil {
+		if err := br.play(); err != nil {
+			return err
+		}
+		br.updateStatus()
+		return nil
+	}
+	if br.shift == nil {
+		return nil
+	}
+	br.shift.Live()
+	return br.startPlayer(br.shift.Stream())
+}
+
+// behind returns how far behind live the time-shifted stream is, like
+// "04:12", or "" if it is live.
+func (br *BossRadio) behind() string {
+	if br.shift == nil {
+		return ""
+	}
+	b := br.shift.Behind()
+	if b < minBehind {
+		return ""
+	}
+	secs := int(b.Seconds())
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%02d:%02d", secs/60, secs%60)
 }
 
 func (br *BossRadio) Destroy() {
+	for _, src := range br.srcs {
+		src.Stop()
+	}
 	br.stop()
+	for _, rec := range br.recs {
+		rec.Stop()
+	}
 	br.scrn.Clear()
+	br.hist.Close()
+	br.bkmks.Close()
 }
 
 // Get preferred outbound ip of this machine
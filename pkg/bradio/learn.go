@@ -0,0 +1,95 @@
+package bradio
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/button"
+	"github.com/nlacasse/boss-radio/pkg/config"
+	"github.com/nlacasse/boss-radio/pkg/events"
+	"github.com/nlacasse/boss-radio/pkg/remote"
+	"github.com/nlacasse/boss-radio/pkg/screen"
+)
+
+// learnTimeout is how long to wait for each key before keeping its old
+// mapping.
+const learnTimeout = 10 * time.Second
+
+// Learn prompts on the screen for each button and remote key in turn, and
+// records in cfg which GPIO pin or lircd key was pressed for it. Keys that are
+// not pressed within learnTimeout keep their old mapping, as do the mappings
+// that Learn does not prompt for.
+func Learn(cfg *config.Config) error {
+	scrn, err := screen.New()
+	if err != nil {
+		return fmt.Errorf("screen.New failed: %v", err)
+	}
+	defer scrn.Clear()
+
+	buttons := copyMap(cfg.Buttons)
+	for _, key := range events.ButtonKeys {
+		prompt(scrn, "Press button", key)
+		pin, err := button.WaitForPress(learnTimeout)
+		if err != nil {
+			log.Printf("learn %v: %v", key, err)
+			continue
+		}
+		log.Printf("learn %v: %s", key, pin)
+		buttons[key.String()] = pin
+		confirm(scrn, pin)
+	}
+
+	remoteKeys := copyMap(cfg.Remote)
+	for _, key := range events.RemoteKeys {
+		prompt(scrn, "Press remote", key)
+		irKey, err := remote.WaitForKey(learnTimeout)
+		if err != nil {
+			log.Printf("learn %v: %v", key, err)
+			continue
+		}
+		log.Printf("learn %v: %s", key, irKey)
+		learnRemote(remoteKeys, string(irKey), key.String())
+		confirm(scrn, string(irKey))
+	}
+
+	cfg.Buttons = buttons
+	cfg.Remote = remoteKeys
+	return nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// learnRemote maps irKey to the key called name in remoteKeys, in place of
+// the lircd keys that name was mapped from before.
+func learnRemote(remoteKeys map[string]string, irKey, name string) {
+	for old, n := range remoteKeys {
+		if n == name {
+			delete(remoteKeys, old)
+		}
+	}
+	remoteKeys[irKey] = name
+}
+
+func prompt(scrn *screen.Screen, what string, key events.Key) {
+	name := strings.TrimPrefix(strings.TrimPrefix(key.String(), "Button"), "Remote")
+	scrn.ClearText()
+	scrn.SetTextLine(0, "    LEARN")
+	scrn.SetTextLine(2, what)
+	scrn.SetTextLine(3, "  "+strings.ToUpper(name))
+	scrn.SetTextLine(5, fmt.Sprintf("(%v to skip)", learnTimeout))
+	scrn.Draw()
+}
+
+func confirm(scrn *screen.Screen, got string) {
+	scrn.SetTextLine(5, "Got "+got)
+	scrn.Draw()
+	time.Sleep(500 * time.Millisecond)
+}
@@ -0,0 +1,27 @@
+package bradio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLearnRemote(t *testing.T) {
+	remoteKeys := map[string]string{
+		"KEY_UP":        "RemoteUp",
+		"KEY_CHANNELUP": "RemoteUp",
+		"KEY_OK":        "RemotePlay",
+		"KEY_MUTE":      "Mute",
+		"KEY_BLUE":      "Record",
+	}
+	learnRemote(remoteKeys, "KEY_NUMERIC_2", "RemoteUp")
+	// The key pressed moves from whatever it was mapped to before.
+	learnRemote(remoteKeys, "KEY_BLUE", "RemotePlay")
+	want := map[string]string{
+		"KEY_NUMERIC_2": "RemoteUp",
+		"KEY_BLUE":      "RemotePlay",
+		"KEY_MUTE":      "Mute",
+	}
+	if !reflect.DeepEqual(remoteKeys, want) {
+		t.Errorf("remote keys = %v, want %v", remoteKeys, want)
+	}
+}
@@ -0,0 +1,314 @@
+package bradio
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// clock abstracts time so that the scheduler can be driven by a fake clock.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type actionKind int
+
+const (
+	actionTune actionKind = iota
+	actionPowerOn
+	actionPowerOff
+	actionRecord
+)
+
+// action is a command issued by the scheduler. stnIdx is -1 when the action
+// does not name a station. dur is how long to record for.
+type action struct {
+	kind   actionKind
+	stnIdx int
+	dur    time.Duration
+}
+
+// rule is a parsed schedule rule like "Tue 15:00 -> WFMU".
+type rule struct {
+	text   string
+	days   [7]bool // Indexed by time.Weekday.
+	hour   int
+	minute int
+	act    action
+}
+
+// scheduledAction is a single upcoming firing of a rule.
+type scheduledAction struct {
+	at   time.Time
+	rule *rule
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseRule parses a rule of the form
+//
+//	<days> <HH:MM> [->] <station>
+//	<days> <HH:MM> [->] power on [<station>]
+//	<days> <HH:MM> [->] power off
+//	<days> <HH:MM> [->] record <station> for <duration>
+//
+// where <days> is "daily", "weekdays", "weekends", a day name, or a comma
+// separated list of day names and ranges like "mon-fri,sun".
+func parseRule(text string, stns []station.Station) (*rule, error) {
+	r := &rule{text: text, act: action{stnIdx: -1}}
+
+	fields := strings.Fields(strings.NewReplacer("→", " ", "->", " ").Replace(text))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("rule %q: want <days> <HH:MM> <action>", text)
+	}
+
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", text, err)
+	}
+	r.days = days
+
+	hm := strings.SplitN(fields[1], ":", 2)
+	if len(hm) != 2 {
+		return nil, fmt.Errorf("rule %q: bad time %q", text, fields[1])
+	}
+	if r.hour, err = strconv.Atoi(hm[0]); err != nil || r.hour < 0 || r.hour > 23 {
+		return nil, fmt.Errorf("rule %q: bad hour %q", text, hm[0])
+	}
+	if r.minute, err = strconv.Atoi(hm[1]); err != nil || r.minute < 0 || r.minute > 59 {
+		return nil, fmt.Errorf("rule %q: bad minute %q", text, hm[1])
+	}
+
+	rest := fields[2:]
+	r.act.kind = actionTune
+	if strings.EqualFold(rest[0], "power") {
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("rule %q: want power on or power off", text)
+		}
+		switch strings.ToLower(rest[1]) {
+		case "on":
+			r.act.kind = actionPowerOn
+		case "off":
+			r.act.kind = actionPowerOff
+			if len(rest) > 2 {
+				return nil, fmt.Errorf("rule %q: power off does not take a station", text)
+			}
+		default:
+			return nil, fmt.Errorf("rule %q: want power on or power off", text)
+		}
+		rest = rest[2:]
+	} else if strings.EqualFold(rest[0], "record") {
+		n := len(rest)
+		if n < 4 || !strings.EqualFold(rest[n-2], "for") {
+			return nil, fmt.Errorf("rule %q: want record <station> for <duration>", text)
+		}
+		r.act.kind = actionRecord
+		if r.act.dur, err = time.ParseDuration(rest[n-1]); err != nil || r.act.dur <= 0 {
+			return nil, fmt.Errorf("rule %q: bad duration %q", text, rest[n-1])
+		}
+		rest = rest[1 : n-2]
+	}
+
+	if len(rest) > 0 {
+		name := strings.Join(rest, " ")
+		for i, stn := range stns {
+			if strings.EqualFold(stn.Name(), name) {
+				r.act.stnIdx = i
+			}
+		}
+		if r.act.stnIdx < 0 {
+			return nil, fmt.Errorf("rule %q: unknown station %q", text, name)
+		}
+	}
+
+	return r, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	switch strings.ToLower(s) {
+	case "daily", "everyday":
+		for d := range days {
+			days[d] = true
+		}
+		return days, nil
+	case "weekdays":
+		for d := time.Monday; d <= time.Friday; d++ {
+			days[d] = true
+		}
+		return days, nil
+	case "weekends":
+		days[time.Saturday] = true
+		days[time.Sunday] = true
+		return days, nil
+	}
+
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := dayNames[from]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		end := start
+		if isRange {
+			if end, ok = dayNames[to]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// next returns the first time strictly after t at which the rule fires.
+func (r *rule) next(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		d := t.AddDate(0, 0, i)
+		at := time.Date(d.Year(), d.Month(), d.Day(), r.hour, r.minute, 0, 0, t.Location())
+		if at.After(t) && r.days[at.Weekday()] {
+			return at
+		}
+	}
+	// Unreachable for rules with at least one day set.
+	return time.Time{}
+}
+
+// scheduleTick is the longest the scheduler sleeps before checking the
+// clock again, so that it keeps up when the clock is set, like by NTP after
+// booting without a real time clock.
+const scheduleTick = time.Minute
+
+type scheduler struct {
+	rules []*rule
+	clock clock
+}
+
+func newScheduler(texts []string, stns []station.Station, clk clock) (*scheduler, error) {
+	s := &scheduler{clock: clk}
+	for _, text := range texts {
+		r, err := parseRule(text, stns)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// upcoming returns the next n firings after t, in order.
+func (s *scheduler) upcoming(t time.Time, n int) []scheduledAction {
+	var sas []scheduledAction
+	for _, r := range s.rules {
+		at := t
+		for i := 0; i < n; i++ {
+			at = r.next(at)
+			sas = append(sas, scheduledAction{at: at, rule: r})
+		}
+	}
+	sort.SliceStable(sas, func(i, j int) bool {
+		return sas[i].at.Before(sas[j].at)
+	})
+	if len(sas) > n {
+		sas = sas[:n]
+	}
+	return sas
+}
+
+// due returns the rules that fire after from and up to now, in order. Rules
+// that would fire more than once only fire the last time.
+func (s *scheduler) due(from, now time.Time) []scheduledAction {
+	var sas []scheduledAction
+	for _, r := range s.rules {
+		var last time.Time
+		for at := r.next(from); !at.After(now); at = r.next(at) {
+			last = at
+		}
+		if !last.IsZero() {
+			sas = append(sas, scheduledAction{at: last, rule: r})
+		}
+	}
+	sort.SliceStable(sas, func(i, j int) bool {
+		return sas[i].at.Before(sas[j].at)
+	})
+	return sas
+}
+
+// run sends each action on ch when it is due, until done is closed. It
+// wakes at least every scheduleTick to check the time. If the clock jumps
+// forward, only the actions due in the last tick fire.
+func (s *scheduler) run(ch chan<- action, done <-chan struct{}) {
+	if len(s.rules) == 0 {
+		return
+	}
+	last := s.clock.Now()
+	for {
+		wait := s.upcoming(last, 1)[0].at.Sub(s.clock.Now())
+		if wait > scheduleTick {
+			wait = scheduleTick
+		}
+		select {
+		case <-s.clock.After(wait):
+		case <-done:
+			return
+		}
+		now := s.clock.Now()
+		from := last
+		if now.Sub(last) > 2*scheduleTick {
+			log.Printf("schedule: clock jumped from %v to %v", last, now)
+			from = now.Add(-scheduleTick)
+		}
+		for _, sa := range s.due(from, now) {
+			log.Printf("schedule: firing %q", sa.rule.text)
+			select {
+			case ch <- sa.rule.act:
+			case <-done:
+				return
+			}
+		}
+		last = now
+	}
+}
+
+// describe returns a human readable description of the action.
+func (a action) describe(stns []station.Station) string {
+	var name string
+	if a.stnIdx >= 0 {
+		name = " " + stns[a.stnIdx].Name()
+	}
+	switch a.kind {
+	case actionTune:
+		return "Tune to" + name
+	case actionPowerOn:
+		return "Power on" + name
+	case actionPowerOff:
+		return "Power off"
+	case actionRecord:
+		return fmt.Sprintf("Record%s for %v", name, a.dur)
+	default:
+		return fmt.Sprintf("unknown action %d", a.kind)
+	}
+}
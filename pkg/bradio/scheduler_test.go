@@ -0,0 +1,169 @@
+package bradio
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// fakeClock is a clock whose time only moves when told to. Its wall time
+// can also be set, like by NTP, without its timers noticing.
+type fakeClock struct {
+	// sleeps gets the duration of each call to After.
+	sleeps chan time.Duration
+
+	mu      sync.Mutex
+	now     time.Time
+	elapsed time.Duration
+	timers  []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Duration
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, sleeps: make(chan time.Duration)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.mu.Lock()
+	c.timers = append(c.timers, fakeTimer{at: c.elapsed + d, ch: ch})
+	c.mu.Unlock()
+	c.sleeps <- d
+	return ch
+}
+
+// advance moves the clock on by d, firing the timers that are due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.elapsed += d
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at <= c.elapsed {
+			t.ch <- c.now
+		} else {
+			timers = append(timers, t)
+		}
+	}
+	c.timers = timers
+}
+
+// set sets the wall time, without firing any timers.
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func TestSchedulerRun(t *testing.T) {
+	stns := []station.Station{
+		station.NewGeneric("A", "http://example.com/a", nil),
+		station.NewGeneric("B", "http://example.com/b", nil),
+	}
+	// A Raspberry Pi without a real time clock boots in 1970.
+	clk := newFakeClock(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, err := newScheduler([]string{"daily 10:00 -> A", "daily 10:01 -> B"}, stns, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan action)
+	done := make(chan struct{})
+	defer close(done)
+	go s.run(ch, done)
+
+	// sleep waits for the scheduler to sleep, and checks for how long.
+	sleep := func(want time.Duration) {
+		t.Helper()
+		select {
+		case d := <-clk.sleeps:
+			if d != want {
+				t.Fatalf("slept for %v, want %v", d, want)
+			}
+		case a := <-ch:
+			t.Fatalf("fired %+v at %v, want a sleep", a, clk.Now())
+		}
+	}
+	fired := func(want int) {
+		t.Helper()
+		select {
+		case a := <-ch:
+			if a.stnIdx != want {
+				t.Fatalf("fired %+v at %v, want station %d", a, clk.Now(), want)
+			}
+		case d := <-clk.sleeps:
+			t.Fatalf("slept for %v at %v, want station %d to fire", d, clk.Now(), want)
+		}
+	}
+
+	sleep(scheduleTick)
+	// NTP sets the clock, and the scheduler notices on its next wake up,
+	// without firing everything since 1970.
+	clk.set(time.Date(2024, 3, 4, 9, 59, 30, 0, time.UTC))
+	clk.advance(scheduleTick)
+	fired(0)
+	sleep(30 * time.Second)
+	clk.advance(30 * time.Second)
+	fired(1)
+
+	// The next day, the rules fire again.
+	for i := 0; i < 24*60-2; i++ {
+		sleep(scheduleTick)
+		clk.advance(scheduleTick)
+	}
+	sleep(scheduleTick)
+	clk.advance(scheduleTick)
+	fired(0)
+	sleep(scheduleTick)
+	clk.advance(scheduleTick)
+	fired(1)
+}
+
+func TestSchedulerDue(t *testing.T) {
+	stns := []station.Station{station.NewGeneric("A", "http://example.com/a", nil)}
+	s, err := newScheduler([]string{"daily 10:00 -> A", "daily 09:00 power off"}, stns, realClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(h, m int) time.Time { return time.Date(2024, 3, 4, h, m, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		from, now time.Time
+		want      []actionKind
+	}{
+		{day(8, 0), day(8, 59), nil},
+		{day(8, 0), day(9, 0), []actionKind{actionPowerOff}},
+		{day(9, 0), day(9, 30), nil},
+		{day(8, 0), day(11, 0), []actionKind{actionPowerOff, actionTune}},
+		// Rules fire once, however much time has gone by.
+		{day(8, 0), day(8, 0).AddDate(0, 0, 3), []actionKind{actionPowerOff, actionTune}},
+		// Nothing fires if the clock went back.
+		{day(11, 0), day(8, 0), nil},
+	} {
+		var got []actionKind
+		for _, sa := range s.due(c.from, c.now) {
+			got = append(got, sa.rule.act.kind)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("due(%v, %v) = %v, want %v", c.from, c.now, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("due(%v, %v) = %v, want %v", c.from, c.now, got, c.want)
+				break
+			}
+		}
+	}
+}
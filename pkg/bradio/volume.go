@@ -0,0 +1,177 @@
+package bradio
+
+import (
+	"fmt"
+
+	"github.com/itchyny/volume-go"
+
+	"github.com/nlacasse/boss-radio/pkg/alsa"
+	"github.com/nlacasse/boss-radio/pkg/config"
+)
+
+// volumeBackend is the mixer that volume changes are applied to.
+type volumeBackend interface {
+	Volume() (int, error)
+	SetVolume(vol int) error
+}
+
+// systemVolume is the default mixer, controlled with volume-go.
+type systemVolume struct{}
+
+func (systemVolume) Volume() (int, error)    { return volume.GetVolume() }
+func (systemVolume) SetVolume(vol int) error { return volume.SetVolume(vol) }
+
+// alsaVolume sets a particular ALSA mixer control. Unless linear is set,
+// percentages follow the control's dB scale, so that each step sounds about
+// as big as the last.
+type alsaVolume struct {
+	card   *alsa.Card
+	ctl    *alsa.Control
+	linear bool
+}
+
+func newAlsaVolume(card, control string, linear bool) (*alsaVolume, error) {
+	c, err := alsa.OpenCard(card)
+	if err != nil {
+		return nil, fmt.Errorf("alsa.OpenCard(%q) failed: %v", card, err)
+	}
+	ctl, err := c.Control(control)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("card %q: %v", card, err)
+	}
+	if ctl.Type != alsa.TypeInteger && ctl.Type != alsa.TypeInteger64 {
+		c.Close()
+		return nil, fmt.Errorf("card %q: control %q is not a volume control", card, control)
+	}
+	if ctl.DB == nil {
+		linear = true
+	}
+	return &alsaVolume{card: c, ctl: ctl, linear: linear}, nil
+}
+
+func (av *alsaVolume) Volume() (int, error) {
+	vals, err := av.card.Values(av.ctl)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, nil
+	}
+	// Report the loudest channel.
+	v := vals[0]
+	for _, val := range vals[1:] {
+		if val > v {
+			v = val
+		}
+	}
+	if !av.linear {
+		return av.ctl.DB.Percent(v), nil
+	}
+	if av.ctl.Max == av.ctl.Min {
+		return 100, nil
+	}
+	return int((v - av.ctl.Min) * 100 / (av.ctl.Max - av.ctl.Min)), nil
+}
+
+func (av *alsaVolume) SetVolume(vol int) error {
+	var v int64
+	if av.linear {
+		v = av.ctl.Min + int64(vol)*(av.ctl.Max-av.ctl.Min)/100
+	} else {
+		v = av.ctl.DB.FromPercent(vol)
+	}
+	return av.card.SetValue(av.ctl, v)
+}
+
+// newVolumeBackend returns the backend chosen in the config.
+func newVolumeBackend(cfg config.Volume) (volumeBackend, error) {
+	switch cfg.Backend {
+	case "", "system":
+		return systemVolume{}, nil
+	case "alsa":
+		return newAlsaVolume(cfg.Card, cfg.Control, cfg.Linear)
+	default:
+		return nil, fmt.Errorf("unknown volume backend %q", cfg.Backend)
+	}
+}
+
+// volumeManager keeps track of the volume the user asked for, and applies it
+// to the backend along with the current station's gain offset, within limits.
+type volumeManager struct {
+	backend  volumeBackend
+	min, max int
+	gains    map[string]int
+
+	// level is the volume the user asked for, before the station's gain.
+	level int
+	gain  int
+	muted bool
+}
+
+func newVolumeManager(backend volumeBackend, min, max int, gains map[string]int) *volumeManager {
+	return &volumeManager{
+		backend: backend,
+		min:     min,
+		max:     max,
+		gains:   gains,
+	}
+}
+
+// init sets the level to startup, or to the backend's current volume if
+// startup is 0.
+func (vm *volumeManager) init(startup int) error {
+	if startup == 0 {
+		vol, err := vm.backend.Volume()
+		if err != nil {
+			return err
+		}
+		startup = vol
+	}
+	return vm.set(startup)
+}
+
+// setStation applies the gain offset of the named station.
+func (vm *volumeManager) setStation(name string) error {
+	vm.gain = vm.gains[name]
+	return vm.apply()
+}
+
+// change changes the level by delta, unmuting if needed.
+func (vm *volumeManager) change(delta int) error {
+	vm.muted = false
+	return vm.set(vm.level + delta)
+}
+
+// set sets the level, within limits.
+func (vm *volumeManager) set(level int) error {
+	vm.level = vm.clamp(level)
+	return vm.apply()
+}
+
+func (vm *volumeManager) toggleMute() error {
+	vm.muted = !vm.muted
+	return vm.apply()
+}
+
+// effective returns the volume that the backend is set to.
+func (vm *volumeManager) effective() int {
+	if vm.muted {
+		return 0
+	}
+	return vm.clamp(vm.level + vm.gain)
+}
+
+func (vm *volumeManager) apply() error {
+	return vm.backend.SetVolume(vm.effective())
+}
+
+func (vm *volumeManager) clamp(vol int) int {
+	if vol < vm.min {
+		return vm.min
+	}
+	if vol > vm.max {
+		return vm.max
+	}
+	return vol
+}
@@ -0,0 +1,157 @@
+package bradio
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeVolume is a volume backend that remembers what it was set to.
+type fakeVolume struct {
+	vol int
+	err error
+}
+
+func (f *fakeVolume) Volume() (int, error) { return f.vol, f.err }
+
+func (f *fakeVolume) SetVolume(vol int) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.vol = vol
+	return nil
+}
+
+func TestVolumeManager(t *testing.T) {
+	gains := map[string]int{"Loud": -10, "Quiet": 15}
+	for _, c := range []struct {
+		name string
+		// start is the backend's volume before init, and startup the
+		// configured startup level.
+		start, startup int
+		do             func(vm *volumeManager) error
+		// level is the level the user asked for, and want what the
+		// backend is set to.
+		level, want int
+	}{
+		{
+			name:  "startup level",
+			start: 30, startup: 50,
+			do:    func(vm *volumeManager) error { return nil },
+			level: 50, want: 50,
+		},
+		{
+			name:  "startup level from the backend",
+			start: 30,
+			do:    func(vm *volumeManager) error { return nil },
+			level: 30, want: 30,
+		},
+		{
+			name:  "startup level clamped",
+			start: 100,
+			do:    func(vm *volumeManager) error { return nil },
+			level: 90, want: 90,
+		},
+		{
+			name:    "set clamped to max",
+			startup: 50,
+			do:      func(vm *volumeManager) error { return vm.set(120) },
+			level:   90, want: 90,
+		},
+		{
+			name:    "change clamped to min",
+			startup: 50,
+			do:      func(vm *volumeManager) error { return vm.change(-60) },
+			level:   10, want: 10,
+		},
+		{
+			name:    "station gain applied",
+			startup: 50,
+			do:      func(vm *volumeManager) error { return vm.setStation("Quiet") },
+			level:   50, want: 65,
+		},
+		{
+			name:    "station gain clamped",
+			startup: 85,
+			do:      func(vm *volumeManager) error { return vm.setStation("Quiet") },
+			level:   85, want: 90,
+		},
+		{
+			name:    "station gain removed on tune",
+			startup: 50,
+			do: func(vm *volumeManager) error {
+				if err := vm.setStation("Loud"); err != nil {
+					return err
+				}
+				return vm.setStation("Plain")
+			},
+			level: 50, want: 50,
+		},
+		{
+			name:    "change keeps the gain",
+			startup: 50,
+			do: func(vm *volumeManager) error {
+				if err := vm.setStation("Loud"); err != nil {
+					return err
+				}
+				return vm.change(5)
+			},
+			level: 55, want: 45,
+		},
+		{
+			name:    "mute",
+			startup: 50,
+			do:      func(vm *volumeManager) error { return vm.toggleMute() },
+			level:   50, want: 0,
+		},
+		{
+			name:    "unmute restores the level",
+			startup: 50,
+			do: func(vm *volumeManager) error {
+				if err := vm.setStation("Quiet"); err != nil {
+					return err
+				}
+				if err := vm.toggleMute(); err != nil {
+					return err
+				}
+				return vm.toggleMute()
+			},
+			level: 50, want: 65,
+		},
+		{
+			name:    "change unmutes",
+			startup: 50,
+			do: func(vm *volumeManager) error {
+				if err := vm.toggleMute(); err != nil {
+					return err
+				}
+				return vm.change(-5)
+			},
+			level: 45, want: 45,
+		},
+	} {
+		backend := &fakeVolume{vol: c.start}
+		vm := newVolumeManager(backend, 10, 90, gains)
+		if err := vm.init(c.startup); err != nil {
+			t.Errorf("%s: init failed: %v", c.name, err)
+			continue
+		}
+		if err := c.do(vm); err != nil {
+			t.Errorf("%s: failed: %v", c.name, err)
+			continue
+		}
+		if vm.level != c.level || backend.vol != c.want {
+			t.Errorf("%s: level %d, volume %d, want level %d, volume %d", c.name, vm.level, backend.vol, c.level, c.want)
+		}
+	}
+}
+
+func TestVolumeManagerErrors(t *testing.T) {
+	backend := &fakeVolume{err: errors.New("no mixer")}
+	vm := newVolumeManager(backend, 10, 90, nil)
+	if err := vm.init(0); err == nil {
+		t.Errorf("init without a volume to start from succeeded")
+	}
+	if err := vm.set(50); err == nil {
+		t.Errorf("set on a broken mixer succeeded")
+	}
+}
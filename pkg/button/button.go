@@ -1,7 +1,9 @@
 package button
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/warthog618/gpiod"
@@ -12,44 +14,209 @@ import (
 
 const gpiochip = "gpiochip0"
 
-type Button struct{}
+// Options holds the pin mapping and gesture timing thresholds.
+type Options struct {
+	// Pins maps each button to the name of the GPIO pin it is wired to.
+	Pins map[events.Key]string
 
-func New() *Button {
-	return &Button{}
+	// LongPress is how long a button must be held to send a LongPress.
+	LongPress time.Duration
+	// DoublePress is the longest gap between a release and the next press
+	// that still counts as a DoublePress.
+	DoublePress time.Duration
 }
 
-func (b *Button) Listen(ch chan<- events.Event) error {
+type Button struct {
+	opts Options
+
+	mu    sync.Mutex
+	chip  *gpiod.Chip
+	lines []*gpiod.Line
+}
+
+func New(opts Options) *Button {
+	return &Button{opts: opts}
+}
+
+// Start watches the buttons' pins and sends their gestures on ch, until ctx
+// is done or Stop is called.
+func (b *Button) Start(ctx context.Context, ch chan<- events.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	chip, err := gpiod.NewChip(gpiochip)
 	if err != nil {
 		return fmt.Errorf("NewChip(%q) failed: %v", gpiochip, err)
 	}
+	b.chip = chip
 
-	btns := map[events.Event]string{
-		events.ButtonLeft:   "gpio14",
-		events.ButtonRight:  "gpio24",
-		events.ButtonUp:     "gpio23",
-		events.ButtonDown:   "gpio8",
-		events.ButtonCenter: "gpio15",
+	for key, pinName := range b.opts.Pins {
+		pin, err := rpi.Pin(pinName)
+		if err != nil {
+			b.stopLocked()
+			return fmt.Errorf("error getting pin %q: %v", pinName, err)
+		}
+		g := &gestures{ctx: ctx, key: key, opts: b.opts, ch: ch}
+		l, err := chip.RequestLine(pin,
+			gpiod.AsInput,
+			gpiod.WithPullUp,
+			gpiod.WithBothEdges,
+			gpiod.WithDebounce(30*time.Millisecond),
+			gpiod.WithEventHandler(g.handle))
+		if err != nil {
+			b.stopLocked()
+			return fmt.Errorf("error getting line for pin %q(%d): %v", pinName, pin, err)
+		}
+		b.lines = append(b.lines, l)
 	}
 
-	for ev, pinName := range btns {
+	go func() {
+		<-ctx.Done()
+		b.Stop()
+	}()
+	return nil
+}
+
+// Stop releases the buttons' pins.
+func (b *Button) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopLocked()
+}
+
+func (b *Button) stopLocked() error {
+	for _, l := range b.lines {
+		l.Close()
+	}
+	b.lines = nil
+	if b.chip == nil {
+		return nil
+	}
+	err := b.chip.Close()
+	b.chip = nil
+	return err
+}
+
+// WaitForPress watches every free GPIO pin and returns the name of the first
+// one that is pulled low, or an error if none is within timeout. It is used to
+// learn which pin a button is wired to.
+func WaitForPress(timeout time.Duration) (string, error) {
+	chip, err := gpiod.NewChip(gpiochip)
+	if err != nil {
+		return "", fmt.Errorf("NewChip(%q) failed: %v", gpiochip, err)
+	}
+	defer chip.Close()
+
+	pressed := make(chan string, 1)
+	for i := 2; i <= 27; i++ {
+		pinName := fmt.Sprintf("gpio%d", i)
 		pin, err := rpi.Pin(pinName)
 		if err != nil {
-			return fmt.Errorf("error getting pin %q: %v", pinName, err)
+			return "", fmt.Errorf("error getting pin %q: %v", pinName, err)
 		}
-		evv := ev
 		handler := func(_ gpiod.LineEvent) {
-			ch <- evv
+			select {
+			case pressed <- pinName:
+			default:
+			}
 		}
-		if _, err := chip.RequestLine(pin,
+		l, err := chip.RequestLine(pin,
 			gpiod.AsInput,
 			gpiod.WithPullUp,
 			gpiod.WithFallingEdge,
 			gpiod.WithDebounce(30*time.Millisecond),
-			gpiod.WithEventHandler(handler)); err != nil {
-			return fmt.Errorf("error getting line for pin %q(%d): %v", pinName, pin, err)
+			gpiod.WithEventHandler(handler))
+		if err != nil {
+			// Pin is in use by something else, e.g. I2C.
+			continue
 		}
+		defer l.Close()
 	}
 
-	return nil
+	select {
+	case pinName := <-pressed:
+		return pinName, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("no button pressed within %v", timeout)
+	}
+}
+
+// gestures turns the edges of a single button into gesture events.
+type gestures struct {
+	ctx  context.Context
+	key  events.Key
+	opts Options
+	ch   chan<- events.Event
+
+	mu sync.Mutex
+	// presses counts presses, so that a stale timer can be told apart.
+	presses int
+	// timer fires the LongPress while the button is held.
+	timer *time.Timer
+	// long is true if the current press has turned into a LongPress.
+	long bool
+	// released is when the button was last released. canDbl is true if the
+	// next press may still be a DoublePress.
+	released time.Duration
+	canDbl   bool
+}
+
+// handle sends the gestures for an edge. It does not hold g.mu while
+// sending, so that a slow reader does not hold up the LongPress timer.
+func (g *gestures) handle(le gpiod.LineEvent) {
+	for _, gst := range g.edge(le) {
+		g.send(gst)
+	}
+}
+
+// edge updates the state for an edge, and returns the gestures it makes.
+func (g *gestures) edge(le gpiod.LineEvent) []events.Gesture {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var gsts []events.Gesture
+	// The buttons are pulled up, so pressing them makes a falling edge.
+	switch le.Type {
+	case gpiod.LineEventFallingEdge:
+		gsts = append(gsts, events.Press)
+		if g.canDbl && le.Timestamp-g.released <= g.opts.DoublePress {
+			gsts = append(gsts, events.DoublePress)
+			g.canDbl = false
+		} else {
+			g.canDbl = true
+		}
+		g.long = false
+		g.presses++
+		n := g.presses
+		g.timer = time.AfterFunc(g.opts.LongPress, func() { g.longPress(n) })
+
+	case gpiod.LineEventRisingEdge:
+		if g.timer != nil {
+			g.timer.Stop()
+			g.timer = nil
+		}
+		if g.long {
+			g.canDbl = false
+		} else {
+			gsts = append(gsts, events.Release)
+		}
+		g.released = le.Timestamp
+	}
+	return gsts
+}
+
+func (g *gestures) longPress(n int) {
+	g.mu.Lock()
+	if g.timer == nil || n != g.presses {
+		// Released in the meantime.
+		g.mu.Unlock()
+		return
+	}
+	g.long = true
+	g.mu.Unlock()
+	g.send(events.LongPress)
+}
+
+func (g *gestures) send(gst events.Gesture) {
+	events.Send(g.ctx, g.ch, events.Event{Key: g.key, Gesture: gst})
 }
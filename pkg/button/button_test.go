@@ -0,0 +1,100 @@
+package button
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/warthog618/gpiod"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+func newGestures(ch chan events.Event) *gestures {
+	return &gestures{
+		ctx: context.Background(),
+		key: events.ButtonCenter,
+		opts: Options{
+			LongPress:   50 * time.Millisecond,
+			DoublePress: 300 * time.Millisecond,
+		},
+		ch: ch,
+	}
+}
+
+func press(ms int) gpiod.LineEvent {
+	return gpiod.LineEvent{Type: gpiod.LineEventFallingEdge, Timestamp: time.Duration(ms) * time.Millisecond}
+}
+
+func release(ms int) gpiod.LineEvent {
+	return gpiod.LineEvent{Type: gpiod.LineEventRisingEdge, Timestamp: time.Duration(ms) * time.Millisecond}
+}
+
+func TestGestures(t *testing.T) {
+	ch := make(chan events.Event, 10)
+	g := newGestures(ch)
+	expect := func(want ...events.Gesture) {
+		t.Helper()
+		for _, gst := range want {
+			select {
+			case ev := <-ch:
+				if ev.Key != events.ButtonCenter || ev.Gesture != gst {
+					t.Errorf("got %v, want %v", ev, gst)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no event, want %v", gst)
+			}
+		}
+		select {
+		case ev := <-ch:
+			t.Errorf("got %v, want nothing more", ev)
+		default:
+		}
+	}
+
+	g.handle(press(0))
+	g.handle(release(10))
+	expect(events.Press, events.Release)
+
+	g.handle(press(100))
+	g.handle(release(110))
+	expect(events.Press, events.DoublePress, events.Release)
+
+	// A third press is not another double press.
+	g.handle(press(200))
+	g.handle(release(210))
+	expect(events.Press, events.Release)
+
+	// Holding the button sends a LongPress instead of a Release.
+	g.handle(press(1000))
+	expect(events.Press)
+	time.Sleep(2 * g.opts.LongPress)
+	g.handle(release(2000))
+	expect(events.LongPress)
+}
+
+// TestGesturesSlowReader checks that the LongPress timer is not held up while
+// an event waits to be read.
+func TestGesturesSlowReader(t *testing.T) {
+	ch := make(chan events.Event)
+	g := newGestures(ch)
+	go g.handle(press(0))
+	time.Sleep(2 * g.opts.LongPress)
+
+	locked := make(chan struct{})
+	go func() {
+		g.mu.Lock()
+		g.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("gestures locked while sending")
+	}
+	for _, want := range []events.Gesture{events.Press, events.LongPress} {
+		if ev := <-ch; ev.Gesture != want {
+			t.Errorf("got %v, want %v", ev, want)
+		}
+	}
+}
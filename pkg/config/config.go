@@ -0,0 +1,491 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"periph.io/x/conn/v3/ir"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+// Config holds the settings that can be changed without a rebuild. It is
+// read from a JSON file at startup.
+type Config struct {
+	// DataDir is where history and other state is kept.
+	DataDir string `json:"data_dir"`
+
+	// Schedule is a list of rules like "Tue 15:00 -> WFMU" or
+	// "weekdays 07:00 power on KFJC".
+	Schedule []string `json:"schedule"`
+
+	// Volume holds the volume limits.
+	Volume Volume `json:"volume"`
+
+	// Stations holds per-station settings, keyed by station name.
+	Stations map[string]Station `json:"stations"`
+	// ShowLoudness measures the loudness of every stream, for the web
+	// status page. Streams that are normalized are always measured.
+	ShowLoudness bool `json:"show_loudness,omitempty"`
+
+	// AudioDevice is the ALSA device to play to, like
+	// "hw:CARD=sndrpihifiberry". It is empty for the system default.
+	AudioDevice string `json:"audio_device,omitempty"`
+	// Outputs are other devices that can be switched to while running,
+	// besides AudioDevice.
+	Outputs []Output `json:"outputs,omitempty"`
+
+	// TimeShift is how much of the current station to keep on disk, for
+	// pausing and rewinding live radio. It is 0, for off, by default, since
+	// the buffer is rewritten all the time and wears SD cards out.
+	TimeShift Duration `json:"time_shift"`
+	// TimeShiftBitrate is the stream bitrate, in kbps, that the time-shift
+	// buffer is sized for.
+	TimeShiftBitrate int `json:"time_shift_bitrate"`
+
+	// RecordDir is where recordings are kept. It defaults to "recordings"
+	// in DataDir.
+	RecordDir string `json:"record_dir,omitempty"`
+
+	// Library is the local music library station.
+	Library Library `json:"library"`
+	// Podcasts is the podcast station.
+	Podcasts Podcasts `json:"podcasts"`
+	// Streams are extra stations that only have a stream URL, like those
+	// added from the station directory.
+	Streams []Stream `json:"streams,omitempty"`
+	// Directory is the radio-browser.info server to search for stations.
+	// It is empty for any of the public servers.
+	Directory string `json:"directory,omitempty"`
+
+	// Path is the file the config was loaded from, and is saved to.
+	Path string `json:"-"`
+
+	// HealthCheck is how often the stations' streams and metadata are
+	// checked. 0 turns checking off.
+	HealthCheck Duration `json:"health_check"`
+	// SkipUnhealthy skips stations that failed their last check when
+	// turning the dial.
+	SkipUnhealthy bool `json:"skip_unhealthy"`
+
+	// LongPress is how long a button must be held to count as a long press.
+	LongPress Duration `json:"long_press"`
+	// DoublePress is the longest gap between two presses of a button that
+	// counts as a double press.
+	DoublePress Duration `json:"double_press"`
+	// VolumeAccel is the number of IR repeats after which each volume step
+	// grows by another notch while the key is held.
+	VolumeAccel int `json:"volume_accel"`
+
+	// Inputs lists the input sources to use. The types are "gpio" for the
+	// buttons, "encoder" for the rotary encoders, "lirc" for the IR remote,
+	// "evdev" for USB and Bluetooth input devices, "keyboard" for the terminal
+	// and "http" for HTTP requests.
+	Inputs []string `json:"inputs"`
+
+	// Buttons maps key names like "ButtonLeft" to the GPIO pins, like
+	// "gpio14", that the buttons are wired to.
+	Buttons map[string]string `json:"buttons"`
+	// Remote maps lircd key names like "KEY_PLAY" to the key names, like
+	// "RemotePlay", that they act as.
+	Remote map[string]string `json:"remote"`
+	// Encoders maps dial key names like "DialTune" and "DialVolume" to the
+	// rotary encoders wired for them.
+	Encoders map[string]Encoder `json:"encoders"`
+	// Evdev maps Linux key names like "KEY_PLAYPAUSE" from input devices to
+	// key names. It adds to and overrides the Remote mapping, since lircd
+	// uses the same key names.
+	Evdev map[string]string `json:"evdev"`
+	// EvdevDevices is a glob matching the input devices to read.
+	EvdevDevices string `json:"evdev_devices"`
+	// EvdevGrab lists globs matching the names of the input devices, like
+	// "BT Media Remote*", to take for boss-radio alone, so that their keys
+	// do not also go to the console. Other devices, like the IR receiver
+	// that lircd reads, are shared.
+	EvdevGrab []string `json:"evdev_grab,omitempty"`
+	// Keyboard maps characters typed on the terminal to key names.
+	Keyboard map[string]string `json:"keyboard"`
+	// HTTPInput is the address that the "http" input listens on.
+	HTTPInput string `json:"http_input"`
+}
+
+// Volume holds the volume limits, in percent.
+type Volume struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Startup is the volume to set at startup. If 0, the volume is left
+	// as it is.
+	Startup int `json:"startup"`
+
+	// Backend is the mixer to use: "system" for the default amixer control,
+	// or "alsa" for the Control of Card.
+	Backend string `json:"backend"`
+	// Card is the ALSA card number or id, like "sndrpihifiberry".
+	Card string `json:"card,omitempty"`
+	// Control is the ALSA mixer control name, like "Digital". Run
+	// "boss-radio controls" to list them.
+	Control string `json:"control,omitempty"`
+	// Linear turns off dB scaling, so that volume steps change the control
+	// by equal raw amounts rather than equal loudness.
+	Linear bool `json:"linear,omitempty"`
+}
+
+// Station holds the settings for a single station.
+type Station struct {
+	// Gain is added to the volume while the station is playing, to even
+	// out loud and quiet stations.
+	Gain int `json:"gain"`
+	// Normalize is the loudness normalization to apply, "loudnorm" or
+	// "dynaudnorm". It is empty for none.
+	Normalize string `json:"normalize,omitempty"`
+	// Player is the player backend, "mpv" or "native". It defaults to mpv.
+	Player string `json:"player,omitempty"`
+	// Device, if set, is the ALSA device that the station always plays to,
+	// whichever output is chosen.
+	Device string `json:"device,omitempty"`
+}
+
+// Output is a named audio device.
+type Output struct {
+	Name   string `json:"name"`
+	Device string `json:"device"`
+}
+
+// Library is a directory of music files to play as a station.
+type Library struct {
+	// Dir is the directory. The library station is left out if it is empty.
+	Dir string `json:"dir,omitempty"`
+	// Shuffle plays the files in a random order, rather than by path.
+	Shuffle bool `json:"shuffle,omitempty"`
+}
+
+// StreamHLS is the Type of streams whose URL is an HLS playlist.
+const StreamHLS = "hls"
+
+// Stream is a station that only has a stream URL.
+type Stream struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Type is StreamHLS if URL is an .m3u8 playlist, or empty for a plain
+	// stream. HLS streams take their metadata from the stream, and have no
+	// fallbacks.
+	Type string `json:"type,omitempty"`
+	// MaxBandwidth, in bits per second, limits the HLS variant played. It
+	// is 0 for no limit.
+	MaxBandwidth int `json:"max_bandwidth,omitempty"`
+	// Fallbacks are tried in order when URL stops working.
+	Fallbacks []Fallback `json:"fallbacks,omitempty"`
+	// Metadata, if set, is where the station's now playing comes from.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata is a JSON or XML now playing endpoint, and the paths to each
+// field in it, like "$.now.artist" or "/playlist/track[1]/@title".
+type Metadata struct {
+	URL string `json:"url"`
+	// XML is true if the endpoint returns XML rather than JSON.
+	XML bool `json:"xml,omitempty"`
+	// ASCII drops the characters that the screen cannot show.
+	ASCII  bool   `json:"ascii,omitempty"`
+	Show   string `json:"show,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Track  string `json:"track,omitempty"`
+	Album  string `json:"album,omitempty"`
+}
+
+// Fallback is another URL that a stream can be played from.
+type Fallback struct {
+	URL string `json:"url"`
+	// Bitrate is in kbps, or 0 if unknown. Lower bitrates are tried first
+	// when the stream keeps running out of data.
+	Bitrate int `json:"bitrate,omitempty"`
+}
+
+// Podcasts are the podcasts to subscribe to.
+type Podcasts struct {
+	// Feeds are the RSS or Atom feed URLs. The podcast station is left out
+	// if there are none.
+	Feeds []string `json:"feeds,omitempty"`
+	// Dir is where episodes are downloaded to. It defaults to "podcasts"
+	// in DataDir.
+	Dir string `json:"dir,omitempty"`
+	// Keep is how many of the newest episodes of each podcast are kept.
+	Keep int `json:"keep"`
+	// Refresh is how often the feeds are checked for new episodes.
+	Refresh Duration `json:"refresh"`
+}
+
+// Encoder describes the GPIO pins a rotary encoder is wired to.
+type Encoder struct {
+	A      string `json:"a"`
+	B      string `json:"b"`
+	Switch string `json:"switch,omitempty"`
+	// StepsPerDetent defaults to 4.
+	StepsPerDetent int `json:"steps_per_detent,omitempty"`
+}
+
+// Duration is a time.Duration that is written as a string like "800ms" in
+// JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	dd, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dd)
+	return nil
+}
+
+// Default returns the config used when no config file exists.
+func Default() *Config {
+	return &Config{
+		DataDir:          "/var/lib/boss-radio",
+		Volume:           Volume{Max: 100, Backend: "system", Card: "0"},
+		TimeShiftBitrate: 320,
+		HealthCheck:      Duration(15 * time.Minute),
+		Podcasts:         Podcasts{Keep: 3, Refresh: Duration(time.Hour)},
+		LongPress:        Duration(800 * time.Millisecond),
+		DoublePress:      Duration(300 * time.Millisecond),
+		VolumeAccel:      4,
+		Inputs:           []string{"gpio", "encoder", "lirc"},
+		Buttons:          defaultButtons(),
+		Remote:           defaultRemote(),
+		Evdev:            defaultEvdev(),
+		EvdevDevices:     "/dev/input/event*",
+		Keyboard:         defaultKeyboard(),
+		HTTPInput:        ":8001",
+	}
+}
+
+// defaultEvdev maps the keys of common media remotes and keyboards.
+func defaultEvdev() map[string]string {
+	return map[string]string{
+		"KEY_PLAYPAUSE":    events.RemotePlay.String(),
+		"KEY_ENTER":        events.RemotePlay.String(),
+		"KEY_OK":           events.RemotePlay.String(),
+		"KEY_VOLUMEUP":     events.RemoteUp.String(),
+		"KEY_VOLUMEDOWN":   events.RemoteDown.String(),
+		"KEY_UP":           events.RemoteUp.String(),
+		"KEY_DOWN":         events.RemoteDown.String(),
+		"KEY_NEXTSONG":     events.RemoteRight.String(),
+		"KEY_PREVIOUSSONG": events.RemoteLeft.String(),
+		"KEY_RIGHT":        events.RemoteRight.String(),
+		"KEY_LEFT":         events.RemoteLeft.String(),
+		"KEY_BOOKMARKS":    events.RemoteMenu.String(),
+		"KEY_PAUSECD":      events.Pause.String(),
+		"KEY_REWIND":       events.Rewind.String(),
+		"KEY_FASTFORWARD":  events.Live.String(),
+		"KEY_RECORD":       events.Record.String(),
+		"KEY_ARCHIVE":      events.Archive.String(),
+	}
+}
+
+func defaultKeyboard() map[string]string {
+	return map[string]string{
+		"w": events.ButtonUp.String(),
+		"s": events.ButtonDown.String(),
+		"a": events.ButtonLeft.String(),
+		"d": events.ButtonRight.String(),
+		" ": events.ButtonCenter.String(),
+		"b": events.RemoteMenu.String(),
+		"m": events.Mute.String(),
+		"p": events.Pause.String(),
+		"o": events.Output.String(),
+		"r": events.Rewind.String(),
+		"l": events.Live.String(),
+		"c": events.Record.String(),
+		"e": events.Archive.String(),
+	}
+}
+
+func defaultButtons() map[string]string {
+	return map[string]string{
+		events.ButtonLeft.String():   "gpio14",
+		events.ButtonRight.String():  "gpio24",
+		events.ButtonUp.String():     "gpio23",
+		events.ButtonDown.String():   "gpio8",
+		events.ButtonCenter.String(): "gpio15",
+	}
+}
+
+// defaultRemote holds the codes for the Apple A1156.
+func defaultRemote() map[string]string {
+	return map[string]string{
+		string(ir.KEY_KPPLUS):      events.RemoteUp.String(),
+		string(ir.KEY_KPMINUS):     events.RemoteDown.String(),
+		string(ir.KEY_REWIND):      events.RemoteLeft.String(),
+		string(ir.KEY_FASTFORWARD): events.RemoteRight.String(),
+		string(ir.KEY_PLAY):        events.RemotePlay.String(),
+		string(ir.KEY_MENU):        events.RemoteMenu.String(),
+		string(ir.KEY_MUTE):        events.Mute.String(),
+		string(ir.KEY_PAUSE):       events.Pause.String(),
+	}
+}
+
+// Load reads the config from path. A missing file is not an error, and
+// results in the default config.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	cfg.Path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Key mappings in the file replace the defaults rather than adding to
+	// them.
+	cfg.Buttons, cfg.Remote, cfg.Evdev, cfg.Keyboard = nil, nil, nil, nil
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg.Buttons == nil {
+		cfg.Buttons = defaultButtons()
+	}
+	if cfg.Remote == nil {
+		cfg.Remote = defaultRemote()
+	}
+	if cfg.Evdev == nil {
+		cfg.Evdev = defaultEvdev()
+	}
+	if cfg.Keyboard == nil {
+		cfg.Keyboard = defaultKeyboard()
+	}
+	for _, s := range cfg.Streams {
+		if s.Type != "" && s.Type != StreamHLS {
+			return nil, fmt.Errorf("stream %s has unknown type %q", s.Name, s.Type)
+		}
+	}
+	return cfg, nil
+}
+
+// Save writes the config to path. It writes a new file and renames it over
+// the old one, so that losing power part way through can not leave a
+// truncated config that fails to load.
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable.
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// ButtonPins returns the GPIO pin for each button key.
+func (c *Config) ButtonPins() (map[events.Key]string, error) {
+	pins := make(map[events.Key]string)
+	for name, pin := range c.Buttons {
+		key, err := events.ParseKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("buttons: %w", err)
+		}
+		pins[key] = pin
+	}
+	return pins, nil
+}
+
+// DialEncoders returns the encoder for each dial key.
+func (c *Config) DialEncoders() (map[events.Key]Encoder, error) {
+	encs := make(map[events.Key]Encoder)
+	for name, enc := range c.Encoders {
+		key, err := events.ParseKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("encoders: %w", err)
+		}
+		encs[key] = enc
+	}
+	return encs, nil
+}
+
+// KeyboardKeys returns the key that each typed character acts as.
+func (c *Config) KeyboardKeys() (map[rune]events.Key, error) {
+	keys := make(map[rune]events.Key)
+	for chars, name := range c.Keyboard {
+		key, err := events.ParseKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("keyboard: %w", err)
+		}
+		r := []rune(chars)
+		if len(r) != 1 {
+			return nil, fmt.Errorf("keyboard: %q is not a single character", chars)
+		}
+		keys[r[0]] = key
+	}
+	return keys, nil
+}
+
+// EvdevKeys returns the key that each Linux key name acts as, from both the
+// Remote and Evdev mappings.
+func (c *Config) EvdevKeys() (map[string]events.Key, error) {
+	keys := make(map[string]events.Key)
+	for _, m := range []map[string]string{c.Remote, c.Evdev} {
+		for name, keyName := range m {
+			key, err := events.ParseKey(keyName)
+			if err != nil {
+				return nil, fmt.Errorf("evdev: %w", err)
+			}
+			keys[name] = key
+		}
+	}
+	return keys, nil
+}
+
+// RemoteKeys returns the key that each lircd key acts as.
+func (c *Config) RemoteKeys() (map[ir.Key]events.Key, error) {
+	keys := make(map[ir.Key]events.Key)
+	for irKey, name := range c.Remote {
+		key, err := events.ParseKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("remote: %w", err)
+		}
+		keys[ir.Key(irKey)] = key
+	}
+	return keys, nil
+}
+
+// DataPath returns the path of the named file in the data directory.
+func (c *Config) DataPath(name string) string {
+	return filepath.Join(c.DataDir, name)
+}
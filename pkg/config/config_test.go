@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "boss-radio.json")
+
+	cfg := Default()
+	cfg.Streams = []Stream{{Name: "KALX", URL: "http://icecast.media.berkeley.edu:8000/kalx-128.mp3"}}
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// Saving again replaces the file.
+	cfg.Streams = append(cfg.Streams, Stream{Name: "HLS", URL: "https://example.com/live.m3u8", Type: StreamHLS})
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(got.Streams) != 2 || !reflect.DeepEqual(got.Streams, cfg.Streams) {
+		t.Errorf("Streams = %+v, want %+v", got.Streams, cfg.Streams)
+	}
+	if got.Path != path {
+		t.Errorf("Path = %q, want %q", got.Path, path)
+	}
+
+	// No temporary files are left behind.
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 {
+		t.Errorf("directory holds %d files, want 1", len(ents))
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("config file mode = %v, %v", fi.Mode(), err)
+	}
+}
+
+func TestLoadUnknownStreamType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boss-radio.json")
+	if err := os.WriteFile(path, []byte(`{"streams": [{"name": "X", "url": "http://x", "type": "dash"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Errorf("Load of a stream with an unknown type succeeded")
+	}
+}
@@ -1,11 +1,15 @@
 package events
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
-type Event int
+// Key identifies a physical button or remote key.
+type Key int
 
 const (
-	ButtonUp Event = iota
+	ButtonUp Key = iota
 	ButtonDown
 	ButtonLeft
 	ButtonRight
@@ -16,10 +20,37 @@ const (
 	RemoteRight
 	RemotePlay
 	RemoteMenu
+	DialTune
+	DialVolume
+	// Mute and Pause are not tied to a particular button, and can be mapped
+	// from any remote or keyboard.
+	Mute
+	Pause
+	// Volume sets the volume to the event's Level.
+	Volume
+	// Output switches the audio output. Press moves to the next output, and
+	// Set picks the output numbered by the event's Level.
+	Output
+	// Rewind moves back in the time-shift buffer: 30 seconds on Press, 5
+	// minutes on LongPress, or the event's Level in seconds on Set.
+	Rewind
+	// Live jumps back to the live stream.
+	Live
+	// Record starts or stops recording the current station.
+	Record
+	// Archive opens the list of the station's archived episodes on Press.
+	// On Set, it plays the episode with the event's ID, or if that is
+	// empty, the one numbered by its Level.
+	Archive
+	// Seek moves through an archived episode, or the time-shift buffer, by
+	// the event's Level in seconds on Set.
+	Seek
+	// Tune tunes to the station numbered by the event's Level on Set.
+	Tune
 )
 
-func (e Event) String() string {
-	switch e {
+func (k Key) String() string {
+	switch k {
 	case ButtonUp:
 		return "ButtonUp"
 	case ButtonDown:
@@ -42,7 +73,150 @@ func (e Event) String() string {
 		return "RemotePlay"
 	case RemoteMenu:
 		return "RemoteMenu"
+	case DialTune:
+		return "DialTune"
+	case DialVolume:
+		return "DialVolume"
+	case Mute:
+		return "Mute"
+	case Pause:
+		return "Pause"
+	case Volume:
+		return "Volume"
+	case Output:
+		return "Output"
+	case Rewind:
+		return "Rewind"
+	case Live:
+		return "Live"
+	case Record:
+		return "Record"
+	case Archive:
+		return "Archive"
+	case Seek:
+		return "Seek"
+	case Tune:
+		return "Tune"
+	default:
+		return fmt.Sprintf("unknown key %d", int(k))
+	}
+}
+
+// ButtonKeys are the keys of the buttons on the radio itself.
+var ButtonKeys = []Key{ButtonUp, ButtonDown, ButtonLeft, ButtonRight, ButtonCenter}
+
+// RemoteKeys are the keys of the IR remote.
+var RemoteKeys = []Key{RemoteUp, RemoteDown, RemoteLeft, RemoteRight, RemotePlay, RemoteMenu}
+
+// DialKeys are the keys of the rotary encoders.
+var DialKeys = []Key{DialTune, DialVolume}
+
+// ParseKey returns the key whose String() is name.
+func ParseKey(name string) (Key, error) {
+	for k := ButtonUp; k <= Tune; k++ {
+		if k.String() == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// Gesture is the way in which a key was pressed.
+type Gesture int
+
+const (
+	// Press is sent as soon as a key goes down.
+	Press Gesture = iota
+	// Release is sent when a key comes back up, unless the press already
+	// turned into a LongPress.
+	Release
+	// LongPress is sent when a key has been held down for a while.
+	LongPress
+	// DoublePress is sent, after the Press, when a key is pressed again
+	// shortly after being released.
+	DoublePress
+	// Repeat is sent repeatedly while a remote key is held down.
+	Repeat
+	// Turn is sent when a dial is turned by one or more detents.
+	Turn
+	// Set is sent to set a level, like the volume, to the event's Level.
+	Set
+)
+
+func (g Gesture) String() string {
+	switch g {
+	case Press:
+		return "Press"
+	case Release:
+		return "Release"
+	case LongPress:
+		return "LongPress"
+	case DoublePress:
+		return "DoublePress"
+	case Repeat:
+		return "Repeat"
+	case Turn:
+		return "Turn"
+	case Set:
+		return "Set"
 	default:
-		return fmt.Sprintf("unknown event %v", e)
+		return fmt.Sprintf("unknown gesture %d", int(g))
+	}
+}
+
+// ParseGesture returns the gesture whose String() is name.
+func ParseGesture(name string) (Gesture, error) {
+	for g := Press; g <= Set; g++ {
+		if g.String() == name {
+			return g, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gesture %q", name)
+}
+
+type Event struct {
+	Key     Key
+	Gesture Gesture
+
+	// Count is the number of Repeat events sent so far for the current
+	// press, starting at 1. It is zero for other gestures.
+	Count int
+
+	// Delta is the number of detents a dial was turned by, positive for
+	// clockwise. Velocity is how fast it was turned, in detents per second.
+	// They are zero for gestures other than Turn.
+	Delta    int
+	Velocity float64
+
+	// Level is the level for a Set gesture.
+	Level int
+	// ID names what a Set gesture picks, where a number could pick the
+	// wrong thing once a list changes.
+	ID string
+}
+
+func (e Event) String() string {
+	switch e.Gesture {
+	case Repeat:
+		return fmt.Sprintf("%v %v #%d", e.Key, e.Gesture, e.Count)
+	case Turn:
+		return fmt.Sprintf("%v %v %+d (%.1f/s)", e.Key, e.Gesture, e.Delta, e.Velocity)
+	case Set:
+		if e.ID != "" {
+			return fmt.Sprintf("%v %v %q", e.Key, e.Gesture, e.ID)
+		}
+		return fmt.Sprintf("%v %v %d", e.Key, e.Gesture, e.Level)
+	}
+	return fmt.Sprintf("%v %v", e.Key, e.Gesture)
+}
+
+// Send sends ev on ch, unless ctx is done first. It returns false if ctx is
+// done, so that sources do not block forever once nobody is listening.
+func Send(ctx context.Context, ch chan<- Event, ev Event) bool {
+	select {
+	case ch <- ev:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
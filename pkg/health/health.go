@@ -0,0 +1,314 @@
+// Package health checks that stations' streams and metadata are working.
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// probeTimeout is how long a stream or metadata endpoint has to answer.
+const probeTimeout = 10 * time.Second
+
+// rebufferWindow is how long the player's rebuffers count against a station.
+const rebufferWindow = time.Hour
+
+// probeBytes is how much of a stream is read to check that it is audio.
+const probeBytes = 8 << 10
+
+// Result is the outcome of checking a station.
+type Result struct {
+	// Checked is when the station was last checked, and LastOK when it last
+	// passed. Problem says what went wrong if it did not.
+	Checked time.Time
+	LastOK  time.Time
+	Problem string
+	// Latency is how long the stream took to send its first audio, and
+	// MetadataLatency how long the metadata endpoint took to answer.
+	Latency         time.Duration
+	MetadataLatency time.Duration
+}
+
+// OK reports whether the last check passed. Stations not checked yet are OK.
+func (r Result) OK() bool {
+	return r.Problem == ""
+}
+
+// Checker checks stations in the background.
+type Checker struct {
+	stns     []station.Station
+	interval time.Duration
+
+	mu      sync.Mutex
+	results map[string]Result
+	// rebuffers are when the player had to wait for data, by station name.
+	rebuffers map[string][]time.Time
+}
+
+// NewChecker returns a checker for stns that checks them every interval.
+func NewChecker(stns []station.Station, interval time.Duration) *Checker {
+	return &Checker{
+		stns:      stns,
+		interval:  interval,
+		results:   make(map[string]Result),
+		rebuffers: make(map[string][]time.Time),
+	}
+}
+
+// Run checks the stations until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	for {
+		c.mu.Lock()
+		stns := c.stns
+		c.mu.Unlock()
+		for _, stn := range stns {
+			c.check(ctx, stn)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		select {
+		case <-time.After(c.interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Add adds a station to be checked from the next round on.
+func (c *Checker) Add(stn station.Station) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stns = append(c.stns, stn)
+}
+
+func (c *Checker) check(ctx context.Context, stn station.Station) {
+	r := Check(ctx, stn)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.OK() {
+		r.LastOK = r.Checked
+	} else {
+		r.LastOK = c.results[stn.Name()].LastOK
+		log.Printf("health: %s: %s", stn.Name(), r.Problem)
+	}
+	c.results[stn.Name()] = r
+}
+
+// Result returns the latest result for the named station.
+func (c *Checker) Result(name string) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[name]
+}
+
+// NoteRebuffers records that the player had to wait for data n times while
+// playing the named station.
+func (c *Checker) NoteRebuffers(name string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		c.rebuffers[name] = append(c.rebuffers[name], now)
+	}
+}
+
+// Rebuffers returns how many times the player had to wait for data while
+// playing the named station in the last hour.
+func (c *Checker) Rebuffers(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.rebuffers[name]
+	for len(ts) > 0 && time.Since(ts[0]) > rebufferWindow {
+		ts = ts[1:]
+	}
+	c.rebuffers[name] = ts
+	return len(ts)
+}
+
+// Check checks a station's stream and metadata endpoint once. A stream with
+// fallbacks passes if any of its sources work. Stations that play from the
+// radio itself or run a command are not checked.
+func Check(ctx context.Context, stn station.Station) Result {
+	r := Result{Checked: time.Now()}
+	if l, ok := stn.(station.Local); ok && l.Local() {
+		return r
+	}
+
+	s := stn.Stream()
+	if len(s.Cmd) == 0 && len(s.Playlist) == 0 {
+		start := time.Now()
+		var err error
+		switch {
+		case s.Open != nil:
+			err = probeOpen(s.Open)
+		case len(s.Sources) > 0:
+			for _, src := range s.Sources {
+				if err = probeURL(ctx, src.URL); err == nil {
+					break
+				}
+			}
+		default:
+			err = probeURL(ctx, s.URL)
+		}
+		r.Latency = time.Since(start)
+		if err != nil {
+			r.Problem = "stream: " + err.Error()
+			return r
+		}
+	}
+
+	if m, ok := stn.(station.Metadater); ok && m.MetadataURL() != "" {
+		start := time.Now()
+		err := probeMetadata(ctx, m.MetadataURL())
+		r.MetadataLatency = time.Since(start)
+		if err != nil {
+			r.Problem = "metadata: " + err.Error()
+		}
+	}
+	return r
+}
+
+// probeURL checks that url serves audio.
+func probeURL(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", url, resp.Status)
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !audioType(ct) {
+		return fmt.Errorf("content type is %q", ct)
+	}
+	return probeAudio(resp.Body)
+}
+
+// probeOpen checks that a stream opened by its station is audio.
+func probeOpen(open func() (io.ReadCloser, error)) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	// Closing the stream unblocks a read that takes too long.
+	t := time.AfterFunc(probeTimeout, func() { rc.Close() })
+	defer t.Stop()
+	defer rc.Close()
+	return probeAudio(rc)
+}
+
+func probeAudio(r io.Reader) error {
+	b := make([]byte, probeBytes)
+	n, err := io.ReadFull(r, b)
+	if err != nil && n == 0 {
+		return err
+	}
+	if !LooksLikeAudio(b[:n]) {
+		return fmt.Errorf("no audio in the first %d bytes", n)
+	}
+	return nil
+}
+
+func probeMetadata(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", url, resp.Status)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// audioType reports whether a stream's content type could be audio. Dead
+// streams often redirect to an HTML page instead.
+func audioType(ct string) bool {
+	switch {
+	case ct == "", strings.HasPrefix(ct, "audio/"):
+		return true
+	case ct == "application/ogg", ct == "application/octet-stream", ct == "video/mp2t":
+		return true
+	}
+	return false
+}
+
+// LooksLikeAudio reports whether b, from the start of a stream, holds audio
+// that can be decoded: MP3 or AAC frames, Ogg pages, FLAC, an ID3 tag or an
+// MPEG transport stream.
+func LooksLikeAudio(b []byte) bool {
+	for _, magic := range []string{"ID3", "OggS", "fLaC"} {
+		if strings.HasPrefix(string(b), magic) {
+			return true
+		}
+	}
+	if len(b) > 188 && b[0] == 0x47 && b[188] == 0x47 {
+		return true
+	}
+	// Streams can start part way through a frame, so look for two frame
+	// headers in a row.
+	for i := 0; i+4 <= len(b); i++ {
+		n := frameLen(b[i:])
+		if n == 0 {
+			continue
+		}
+		if i+n+4 <= len(b) && frameLen(b[i+n:]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mp3Bitrates are the MPEG-1 Layer III bitrates in kbps, by index.
+var mp3Bitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+
+// mp3SampleRates are the MPEG-1 sample rates, by index.
+var mp3SampleRates = [4]int{44100, 48000, 32000, 0}
+
+// frameLen returns the length of the MPEG-1 Layer III or ADTS AAC frame whose
+// header starts b, or 0 if b does not start with one.
+func frameLen(b []byte) int {
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return 0
+	}
+	if b[1]&0x06 == 0 {
+		// ADTS, whose frame length includes the header.
+		n := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+		if n < 7 {
+			return 0
+		}
+		return n
+	}
+	if b[1]&0x0e != 0x0a {
+		// Only MPEG-1 Layer III is common in streams.
+		return 0
+	}
+	br, sr := mp3Bitrates[b[2]>>4], mp3SampleRates[(b[2]>>2)&0x03]
+	if br == 0 || sr == 0 {
+		return 0
+	}
+	return 144*br*1000/sr + int(b[2]>>1&0x01)
+}
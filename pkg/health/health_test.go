@@ -0,0 +1,164 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// mp3Header is an MPEG-1 Layer III frame header for 128 kbps at 44.1 kHz,
+// without padding, whose frames are 417 bytes.
+var mp3Header = []byte{0xff, 0xfb, 0x90, 0x00}
+
+// adtsHeader is an ADTS AAC frame header for a 200 byte frame.
+var adtsHeader = []byte{0xff, 0xf1, 0x50, 0x80, 0x19, 0x1f, 0xfc}
+
+// frames returns n frames of size bytes, each starting with header.
+func frames(header []byte, size, n int) []byte {
+	var b []byte
+	for i := 0; i < n; i++ {
+		f := make([]byte, size)
+		copy(f, header)
+		b = append(b, f...)
+	}
+	return b
+}
+
+func tsPackets(n int) []byte {
+	return frames([]byte{0x47, 0x40, 0x00, 0x10}, 188, n)
+}
+
+const html = "<!DOCTYPE html><html><head><title>Stream offline</title></head><body>Sorry</body></html>"
+
+func TestFrameLen(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{"MP3", mp3Header, 417},
+		{"MP3 padded", []byte{0xff, 0xfb, 0x92, 0x00}, 418},
+		{"MP3 320 kbps at 48 kHz", []byte{0xff, 0xfb, 0xe4, 0x00}, 960},
+		{"ADTS", adtsHeader, 200},
+		{"ADTS too short", []byte{0xff, 0xf1, 0x50, 0x80, 0x00, 0x1f, 0xfc}, 0},
+		{"MP3 free bitrate", []byte{0xff, 0xfb, 0x00, 0x00}, 0},
+		{"MP3 bad bitrate", []byte{0xff, 0xfb, 0xf0, 0x00}, 0},
+		{"MP3 reserved sample rate", []byte{0xff, 0xfb, 0x9c, 0x00}, 0},
+		{"MPEG-2 Layer III", []byte{0xff, 0xf3, 0x90, 0x00}, 0},
+		{"MPEG-1 Layer II", []byte{0xff, 0xfd, 0x90, 0x00}, 0},
+		{"no sync", []byte{0xfe, 0xfb, 0x90, 0x00}, 0},
+		{"HTML", []byte(html), 0},
+	} {
+		b := make([]byte, 8)
+		copy(b, c.header)
+		if got := frameLen(b); got != c.want {
+			t.Errorf("%s: frameLen = %d, want %d", c.name, got, c.want)
+		}
+	}
+	if got := frameLen(mp3Header); got != 0 {
+		t.Errorf("frameLen of a cut off header = %d, want 0", got)
+	}
+}
+
+func TestLooksLikeAudio(t *testing.T) {
+	mp3 := frames(mp3Header, 417, 4)
+	for _, c := range []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{"MP3", mp3, true},
+		{"MP3 from mid-frame", mp3[300:], true},
+		{"ADTS", frames(adtsHeader, 200, 4), true},
+		{"ADTS from mid-frame", frames(adtsHeader, 200, 4)[150:], true},
+		{"ID3", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), mp3...), true},
+		{"Ogg", []byte("OggS\x00\x02\x00\x00"), true},
+		{"FLAC", []byte("fLaC\x00\x00\x00\x22"), true},
+		{"TS", tsPackets(3), true},
+		{"TS too short", tsPackets(1), false},
+		{"one MP3 frame header", frames(mp3Header, 417, 1), false},
+		{"HTML", []byte(strings.Repeat(html, 100)), false},
+		{"silence", make([]byte, 4096), false},
+		{"empty", nil, false},
+	} {
+		if got := LooksLikeAudio(c.b); got != c.want {
+			t.Errorf("%s: LooksLikeAudio = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestAudioType(t *testing.T) {
+	for _, c := range []struct {
+		ct   string
+		want bool
+	}{
+		{"", true},
+		{"audio/mpeg", true},
+		{"audio/aacp", true},
+		{"application/ogg", true},
+		{"application/octet-stream", true},
+		{"video/mp2t", true},
+		{"text/html", false},
+		{"application/json", false},
+	} {
+		if got := audioType(c.ct); got != c.want {
+			t.Errorf("audioType(%q) = %v, want %v", c.ct, got, c.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mp3", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(frames(mp3Header, 417, 30))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(html))
+	})
+	mux.HandleFunc("/octet", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(bytes.Repeat([]byte(html), 100))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	src := func(path string) player.Source { return player.Source{URL: srv.URL + path} }
+	for _, c := range []struct {
+		name string
+		stn  station.Station
+		// problem is part of the problem found, or empty for none.
+		problem string
+	}{
+		{"MP3", station.NewGeneric("MP3", srv.URL+"/mp3", nil), ""},
+		{"HTML", station.NewGeneric("HTML", srv.URL+"/html", nil), `content type is "text/html"`},
+		{"not audio", station.NewGeneric("Octet", srv.URL+"/octet", nil), "no audio"},
+		{"missing", station.NewGeneric("Missing", srv.URL+"/missing", nil), "404"},
+		{"fallback works", station.NewGeneric("Fallback", srv.URL+"/missing", nil, src("/html"), src("/mp3")), ""},
+		{"first source works", station.NewGeneric("First", srv.URL+"/mp3", nil, src("/missing")), ""},
+		{"no source works", station.NewGeneric("None", srv.URL+"/missing", nil, src("/html")), "stream:"},
+		{
+			"metadata fails",
+			station.NewGeneric("Metadata", srv.URL+"/mp3", &station.Metadata{URL: srv.URL + "/missing", Show: "show"}),
+			"metadata: GET",
+		},
+	} {
+		r := Check(context.Background(), c.stn)
+		if c.problem == "" {
+			if !r.OK() {
+				t.Errorf("%s: Check found %q, want no problem", c.name, r.Problem)
+			}
+			continue
+		}
+		if r.OK() || !strings.Contains(r.Problem, c.problem) {
+			t.Errorf("%s: Check found %q, want a problem mentioning %q", c.name, r.Problem, c.problem)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a single thing that was playing at a point in time.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Station string    `json:"station"`
+	Show    string    `json:"show,omitempty"`
+	Artist  string    `json:"artist,omitempty"`
+	Track   string    `json:"track,omitempty"`
+	Album   string    `json:"album,omitempty"`
+}
+
+// SameAs returns true if e and o describe the same thing, ignoring the time.
+func (e Entry) SameAs(o Entry) bool {
+	e.Time = o.Time
+	return e == o
+}
+
+// Empty returns true if the entry has no metadata besides the station.
+func (e Entry) Empty() bool {
+	return e.Show == "" && e.Artist == "" && e.Track == "" && e.Album == ""
+}
+
+// Store is an append-only log of entries, kept as one JSON object per line.
+type Store struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens the store at path, creating it if it does not exist.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := endLine(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Store{path: path, f: f}, nil
+}
+
+// endLine ends a line cut short at the end of f, so that the next entry
+// appended is not lost with it.
+func endLine(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, fi.Size()-1); err != nil {
+		return fmt.Errorf("reading %s failed: %v", f.Name(), err)
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = f.Write([]byte{'\n'})
+	return err
+}
+
+func (s *Store) Append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+// All returns every entry in the store, oldest first.
+func (s *Store) All() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var es []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Likely a line cut short by a power cut while appending.
+			log.Printf("%s:%d: skipping bad entry: %v", s.path, line, err)
+			continue
+		}
+		es = append(es, e)
+	}
+	return es, scanner.Err()
+}
+
+// List returns up to limit entries, newest first, skipping the first offset
+// of them. It also returns the total number of entries.
+func (s *Store) List(offset, limit int) ([]Entry, int, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(all)
+	if offset < 0 {
+		offset = 0
+	}
+	var es []Entry
+	for i := total - 1 - offset; i >= 0 && len(es) < limit; i-- {
+		es = append(es, all[i])
+	}
+	return es, total, nil
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,82 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer s.Close()
+	start := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := Entry{Time: start.Add(time.Duration(i) * time.Minute), Station: "KFJC", Track: strconv.Itoa(i)}
+		if err := s.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 2, "43"},
+		{2, 2, "21"},
+		{4, 2, "0"},
+		{5, 2, ""},
+		{0, 10, "43210"},
+		// Negative offsets count from the newest, rather than panicking.
+		{-5, 2, "43"},
+	} {
+		es, total, err := s.List(c.offset, c.limit)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		var got string
+		for _, e := range es {
+			got += e.Track
+		}
+		if got != c.want || total != 5 {
+			t.Errorf("List(%d, %d) = %q of %d, want %q of 5", c.offset, c.limit, got, total, c.want)
+		}
+	}
+}
+
+// TestCorruptLines checks that entries cut short, like by a power cut while
+// appending, are skipped, and do not take the next entry with them.
+func TestCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	data := `{"station":"KFJC","track":"0"}
+not json
+{"station":"KFJC","track":"1"}
+{"station":"KFJC","tr`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer s.Close()
+	if err := s.Append(Entry{Station: "KFJC", Track: "2"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	es, err := s.All()
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	var got string
+	for _, e := range es {
+		got += e.Track
+	}
+	if got != "012" {
+		t.Errorf("tracks = %q, want %q", got, "012")
+	}
+}
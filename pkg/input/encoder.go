@@ -0,0 +1,260 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpiod"
+	"github.com/warthog618/gpiod/device/rpi"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+const gpiochip = "gpiochip0"
+
+// transitions holds the step for each quadrature transition, indexed by
+// old<<2|new where each state is a<<1|b. Invalid transitions, where both lines
+// changed at once, count as 0.
+var transitions = [16]int{
+	0, +1, -1, 0,
+	-1, 0, 0, +1,
+	+1, 0, 0, -1,
+	0, -1, +1, 0,
+}
+
+// Decoder turns the levels of a quadrature encoder's A and B lines into
+// detents. It is not safe for concurrent use.
+type Decoder struct {
+	stepsPerDetent int
+	// rest is the state of the lines while resting in a detent.
+	rest    int
+	state   int
+	acc     int
+	last    time.Duration
+	hasLast bool
+}
+
+// NewDecoder returns a decoder for an encoder that makes stepsPerDetent
+// quadrature steps per detent, starting with lines at levels a and b.
+func NewDecoder(stepsPerDetent int, a, b bool) *Decoder {
+	if stepsPerDetent <= 0 {
+		stepsPerDetent = 4
+	}
+	return &Decoder{
+		stepsPerDetent: stepsPerDetent,
+		rest:           levels(a, b),
+		state:          levels(a, b),
+	}
+}
+
+// resting returns true if s is a state that the encoder rests in at a
+// detent. Encoders with two steps per detent rest in both states where the
+// lines are equal or both where they differ.
+func (d *Decoder) resting(s int) bool {
+	switch d.stepsPerDetent {
+	case 1:
+		return true
+	case 2:
+		return s == d.rest || s == d.rest^3
+	}
+	return s == d.rest
+}
+
+func levels(a, b bool) int {
+	s := 0
+	if a {
+		s |= 2
+	}
+	if b {
+		s |= 1
+	}
+	return s
+}
+
+// Update takes the levels of the lines at time at, and returns the number of
+// detents turned since the last detent, positive for clockwise, along with
+// the speed of the turn in detents per second. Bounces cancel out, so delta
+// is only non-zero once the encoder has settled in its next detent. Steps are
+// counted afresh from each detent, so a missed edge only loses that detent if
+// more than half its steps are missed.
+func (d *Decoder) Update(a, b bool, at time.Duration) (delta int, velocity float64) {
+	s := levels(a, b)
+	d.acc += transitions[d.state<<2|s]
+	d.state = s
+	if !d.resting(s) {
+		return 0, 0
+	}
+
+	// Round to the nearest detent.
+	half := d.stepsPerDetent / 2
+	if d.acc < 0 {
+		half = -half
+	}
+	delta = (d.acc + half) / d.stepsPerDetent
+	d.acc = 0
+	if delta == 0 {
+		return 0, 0
+	}
+
+	if d.hasLast && at > d.last {
+		velocity = float64(abs(delta)) / (at - d.last).Seconds()
+	}
+	d.last = at
+	d.hasLast = true
+	return delta, velocity
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// EncoderOptions describes how a rotary encoder is wired.
+type EncoderOptions struct {
+	// A and B are the GPIO pins of the quadrature lines, like "gpio5".
+	A, B string
+	// Switch is the GPIO pin of the push switch, if any.
+	Switch string
+	// StepsPerDetent is the number of quadrature steps between detents,
+	// usually 4.
+	StepsPerDetent int
+}
+
+// Encoder is a rotary encoder wired to GPIO pins. Its turns are sent as Turn
+// events for its key, and its push switch as Press and Release.
+type Encoder struct {
+	key  events.Key
+	opts EncoderOptions
+
+	mu    sync.Mutex
+	chip  *gpiod.Chip
+	lines []io.Closer
+}
+
+var _ Source = (*Encoder)(nil)
+
+func NewEncoder(key events.Key, opts EncoderOptions) *Encoder {
+	return &Encoder{key: key, opts: opts}
+}
+
+func (e *Encoder) Start(ctx context.Context, ch chan<- events.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.startLocked(ctx, ch); err != nil {
+		e.stopLocked()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		e.Stop()
+	}()
+	return nil
+}
+
+func (e *Encoder) startLocked(ctx context.Context, ch chan<- events.Event) error {
+	chip, err := gpiod.NewChip(gpiochip)
+	if err != nil {
+		return fmt.Errorf("NewChip(%q) failed: %v", gpiochip, err)
+	}
+	e.chip = chip
+
+	pinA, err := rpi.Pin(e.opts.A)
+	if err != nil {
+		return fmt.Errorf("error getting pin %q: %v", e.opts.A, err)
+	}
+	pinB, err := rpi.Pin(e.opts.B)
+	if err != nil {
+		return fmt.Errorf("error getting pin %q: %v", e.opts.B, err)
+	}
+
+	// Read the lines' current levels to start decoding from.
+	lines, err := chip.RequestLines([]int{pinA, pinB}, gpiod.AsInput, gpiod.WithPullUp)
+	if err != nil {
+		return fmt.Errorf("error getting lines for pins %q, %q: %v", e.opts.A, e.opts.B, err)
+	}
+	vals := make([]int, 2)
+	err = lines.Values(vals)
+	lines.Close()
+	if err != nil {
+		return fmt.Errorf("error reading pins %q, %q: %v", e.opts.A, e.opts.B, err)
+	}
+
+	var mu sync.Mutex
+	a, b := vals[0] == 1, vals[1] == 1
+	dec := NewDecoder(e.opts.StepsPerDetent, a, b)
+	handler := func(le gpiod.LineEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		high := le.Type == gpiod.LineEventRisingEdge
+		if le.Offset == pinA {
+			a = high
+		} else {
+			b = high
+		}
+		if delta, v := dec.Update(a, b, le.Timestamp); delta != 0 {
+			events.Send(ctx, ch, events.Event{Key: e.key, Gesture: events.Turn, Delta: delta, Velocity: v})
+		}
+	}
+	// No debounce: bounces are just steps back and forth, which cancel out.
+	lines, err = chip.RequestLines([]int{pinA, pinB},
+		gpiod.AsInput,
+		gpiod.WithPullUp,
+		gpiod.WithBothEdges,
+		gpiod.WithEventHandler(handler))
+	if err != nil {
+		return fmt.Errorf("error watching pins %q, %q: %v", e.opts.A, e.opts.B, err)
+	}
+	e.lines = append(e.lines, lines)
+
+	if e.opts.Switch == "" {
+		return nil
+	}
+	pinSw, err := rpi.Pin(e.opts.Switch)
+	if err != nil {
+		return fmt.Errorf("error getting pin %q: %v", e.opts.Switch, err)
+	}
+	swHandler := func(le gpiod.LineEvent) {
+		// The switch is pulled up, so pressing it makes a falling edge.
+		gst := events.Release
+		if le.Type == gpiod.LineEventFallingEdge {
+			gst = events.Press
+		}
+		events.Send(ctx, ch, events.Event{Key: e.key, Gesture: gst})
+	}
+	sw, err := chip.RequestLine(pinSw,
+		gpiod.AsInput,
+		gpiod.WithPullUp,
+		gpiod.WithBothEdges,
+		gpiod.WithDebounce(30*time.Millisecond),
+		gpiod.WithEventHandler(swHandler))
+	if err != nil {
+		return fmt.Errorf("error getting line for pin %q(%d): %v", e.opts.Switch, pinSw, err)
+	}
+	e.lines = append(e.lines, sw)
+	return nil
+}
+
+// Stop releases the encoder's pins.
+func (e *Encoder) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stopLocked()
+}
+
+func (e *Encoder) stopLocked() error {
+	for _, l := range e.lines {
+		l.Close()
+	}
+	e.lines = nil
+	if e.chip == nil {
+		return nil
+	}
+	err := e.chip.Close()
+	e.chip = nil
+	return err
+}
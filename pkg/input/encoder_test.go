@@ -0,0 +1,55 @@
+package input
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecoder(t *testing.T) {
+	// States are a<<1|b. Turning clockwise goes 0, 1, 3, 2, 0.
+	for _, c := range []struct {
+		name  string
+		steps int
+		// states are the states after the first, 0, and deltas the detents
+		// that each returns.
+		states []int
+		deltas []int
+	}{
+		{"clockwise", 4, []int{1, 3, 2, 0}, []int{0, 0, 0, 1}},
+		{"counter-clockwise", 4, []int{2, 3, 1, 0}, []int{0, 0, 0, -1}},
+		{"two detents", 4, []int{1, 3, 2, 0, 1, 3, 2, 0}, []int{0, 0, 0, 1, 0, 0, 0, 1}},
+		{"bounce", 4, []int{1, 0, 1, 3, 2, 3, 2, 0}, []int{0, 0, 0, 0, 0, 0, 0, 1}},
+		{"bounce at the detent", 4, []int{1, 3, 2, 0, 2, 0}, []int{0, 0, 0, 1, 0, 0}},
+		{"reversal before the detent", 4, []int{1, 3, 1, 0}, []int{0, 0, 0, 0}},
+		{"reversal after the detent", 4, []int{1, 3, 2, 0, 2, 3, 1, 0}, []int{0, 0, 0, 1, 0, 0, 0, -1}},
+		// A missed edge still makes a detent, and the next detent is
+		// counted afresh rather than half a step off.
+		{"dropped transition", 4, []int{1, 3, 0, 1, 3, 2, 0}, []int{0, 0, 1, 0, 0, 0, 1}},
+		{"dropped first transition", 4, []int{3, 2, 0, 2, 3, 1, 0}, []int{0, 0, 1, 0, 0, 0, -1}},
+		{"dropped transition bouncing back", 4, []int{1, 3, 1, 3, 0}, []int{0, 0, 0, 0, 1}},
+		{"bounce to the next state and back", 4, []int{1, 0}, []int{0, 0}},
+		{"two steps per detent", 2, []int{1, 3, 2, 0}, []int{0, 1, 0, 1}},
+		{"two steps per detent, dropped", 2, []int{3, 2, 0}, []int{0, 0, 1}},
+	} {
+		d := NewDecoder(c.steps, false, false)
+		for i, s := range c.states {
+			at := time.Duration(i) * 10 * time.Millisecond
+			if got, _ := d.Update(s&2 != 0, s&1 != 0, at); got != c.deltas[i] {
+				t.Errorf("%s: step %d to state %d = %d, want %d", c.name, i, s, got, c.deltas[i])
+			}
+		}
+	}
+}
+
+func TestDecoderVelocity(t *testing.T) {
+	d := NewDecoder(1, false, false)
+	if delta, v := d.Update(false, true, 0); delta != 1 || v != 0 {
+		t.Errorf("first detent = %d at %v, want 1 at 0", delta, v)
+	}
+	if delta, v := d.Update(true, true, 500*time.Millisecond); delta != 1 || v != 2 {
+		t.Errorf("second detent = %d at %v, want 1 at 2 per second", delta, v)
+	}
+	if delta, v := d.Update(true, false, 500*time.Millisecond); delta != 1 || v != 0 {
+		t.Errorf("detent at the same time = %d at %v, want 1 at 0", delta, v)
+	}
+}
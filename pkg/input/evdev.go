@@ -0,0 +1,282 @@
+package input
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+// evKey is the input_event type of key presses.
+const evKey = 0x01
+
+// eviocgrab is the EVIOCGRAB ioctl from input.h, _IOW('E', 0x90, int), and
+// eviocgname the EVIOCGNAME(256) one, _IOC(_IOC_READ, 'E', 0x06, 256).
+const (
+	eviocgrab  = 0x40044590
+	eviocgname = 0x81004506
+)
+
+// evdevScanInterval is how often to look for newly plugged in devices.
+const evdevScanInterval = 2 * time.Second
+
+// eventSize is the size of struct input_event, which starts with a struct
+// timeval and so depends on the word size.
+var eventSize = int(unsafe.Sizeof(unix.Timeval{})) + 8
+
+// EvdevCodes maps Linux key names, as used by lircd, to their evdev codes
+// from input-event-codes.h.
+var EvdevCodes = map[string]uint16{
+	"KEY_ESC":          1,
+	"KEY_ENTER":        28,
+	"KEY_SPACE":        57,
+	"KEY_KPMINUS":      74,
+	"KEY_KPPLUS":       78,
+	"KEY_HOME":         102,
+	"KEY_UP":           103,
+	"KEY_LEFT":         105,
+	"KEY_RIGHT":        106,
+	"KEY_DOWN":         108,
+	"KEY_MUTE":         113,
+	"KEY_VOLUMEDOWN":   114,
+	"KEY_VOLUMEUP":     115,
+	"KEY_POWER":        116,
+	"KEY_PAUSE":        119,
+	"KEY_STOP":         128,
+	"KEY_MENU":         139,
+	"KEY_BOOKMARKS":    156,
+	"KEY_BACK":         158,
+	"KEY_FORWARD":      159,
+	"KEY_NEXTSONG":     163,
+	"KEY_PLAYPAUSE":    164,
+	"KEY_PREVIOUSSONG": 165,
+	"KEY_STOPCD":       166,
+	"KEY_RECORD":       167,
+	"KEY_REWIND":       168,
+	"KEY_PLAYCD":       200,
+	"KEY_PAUSECD":      201,
+	"KEY_PLAY":         207,
+	"KEY_FASTFORWARD":  208,
+	"KEY_OK":           352,
+	"KEY_SELECT":       353,
+	"KEY_ARCHIVE":      361,
+	"KEY_FAVORITES":    364,
+	"KEY_CHANNELUP":    402,
+	"KEY_CHANNELDOWN":  403,
+}
+
+// Evdev reads key presses from Linux input devices, like USB and Bluetooth
+// media remotes and keyboards. Devices matching its glob are opened as they
+// are plugged in.
+type Evdev struct {
+	glob string
+	grab []string
+	keys map[uint16]events.Key
+
+	mu    sync.Mutex
+	devs  map[string]*os.File
+	close chan struct{}
+}
+
+var _ Source = (*Evdev)(nil)
+
+// NewEvdev returns a source that reads from the devices matching glob, like
+// "/dev/input/event*", and maps their key codes to keys. Devices whose names
+// match one of the globs in grab are grabbed, so that nothing else gets
+// their keys.
+func NewEvdev(glob string, grab []string, keys map[uint16]events.Key) *Evdev {
+	return &Evdev{glob: glob, grab: grab, keys: keys}
+}
+
+func (e *Evdev) Start(ctx context.Context, ch chan<- events.Event) error {
+	e.mu.Lock()
+	e.devs = make(map[string]*os.File)
+	e.close = make(chan struct{})
+	done := e.close
+	e.mu.Unlock()
+
+	if _, err := filepath.Glob(e.glob); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(evdevScanInterval)
+		defer ticker.Stop()
+		for {
+			e.scan(ctx, ch)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				e.Stop()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// scan opens any matching devices that are not open yet.
+func (e *Evdev) scan(ctx context.Context, ch chan<- events.Event) {
+	paths, _ := filepath.Glob(e.glob)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.devs == nil {
+		// Stopped.
+		return
+	}
+	for _, path := range paths {
+		if _, ok := e.devs[path]; ok {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			// Not ours to read, or gone again.
+			continue
+		}
+		name, err := deviceName(f)
+		if err != nil {
+			log.Printf("evdev: reading the name of %s failed: %v", path, err)
+		}
+		if matchAny(e.grab, name) {
+			// The grab is released when the file is closed.
+			if err := grab(f); err != nil {
+				log.Printf("evdev: grabbing %s failed: %v", path, err)
+			} else {
+				log.Printf("evdev: grabbed %s (%s)", path, name)
+			}
+		}
+		log.Printf("evdev: opened %s (%s)", path, name)
+		e.devs[path] = f
+		go func(path string) {
+			err := ReadEvdev(ctx, f, e.keys, ch)
+			log.Printf("evdev: closing %s: %v", path, err)
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if e.devs[path] == f {
+				delete(e.devs, path)
+				f.Close()
+			}
+		}(path)
+	}
+}
+
+// matchAny returns true if name matches any of globs.
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// grab takes f's device for itself.
+func grab(f *os.File) error {
+	return control(f, func(fd int) error {
+		return unix.IoctlSetInt(fd, eviocgrab, 1)
+	})
+}
+
+// deviceName returns the name of f's device, like "BT Media Remote".
+func deviceName(f *os.File) (string, error) {
+	buf := make([]byte, 256)
+	err := control(f, func(fd int) error {
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), eviocgname, uintptr(unsafe.Pointer(&buf[0])))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(buf), nil
+}
+
+// control runs fn on f's file descriptor. It avoids f.Fd, which would make
+// reads block in a way that closing f does not interrupt.
+func control(f *os.File, fn func(fd int) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) {
+		ferr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func (e *Evdev) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.devs == nil {
+		return nil
+	}
+	for _, f := range e.devs {
+		f.Close()
+	}
+	e.devs = nil
+	close(e.close)
+	return nil
+}
+
+// ReadEvdev reads input_event structs from r and sends the key events among
+// them on ch, until r fails or ctx is done. Keys missing from keys are
+// ignored.
+func ReadEvdev(ctx context.Context, r io.Reader, keys map[uint16]events.Key, ch chan<- events.Event) error {
+	buf := make([]byte, eventSize)
+	tv := eventSize - 8
+	var count int
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		typ := binary.LittleEndian.Uint16(buf[tv:])
+		code := binary.LittleEndian.Uint16(buf[tv+2:])
+		value := int32(binary.LittleEndian.Uint32(buf[tv+4:]))
+		if typ != evKey {
+			continue
+		}
+		key, ok := keys[code]
+		if !ok {
+			continue
+		}
+
+		ev := events.Event{Key: key}
+		switch value {
+		case 0:
+			ev.Gesture = events.Release
+		case 1:
+			ev.Gesture = events.Press
+			count = 0
+		case 2:
+			count++
+			ev.Gesture = events.Repeat
+			ev.Count = count
+		default:
+			continue
+		}
+		if !events.Send(ctx, ch, ev) {
+			return ctx.Err()
+		}
+	}
+}
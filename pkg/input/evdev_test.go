@@ -0,0 +1,115 @@
+package input
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+// inputEvent returns a struct input_event as the kernel writes it.
+func inputEvent(typ, code uint16, value int32) []byte {
+	buf := make([]byte, eventSize)
+	tv := eventSize - 8
+	// Put something in the timestamp, which should be skipped.
+	for i := 0; i < tv; i++ {
+		buf[i] = 0xff
+	}
+	binary.LittleEndian.PutUint16(buf[tv:], typ)
+	binary.LittleEndian.PutUint16(buf[tv+2:], code)
+	binary.LittleEndian.PutUint32(buf[tv+4:], uint32(value))
+	return buf
+}
+
+func TestReadEvdev(t *testing.T) {
+	const evSyn, evMsc = 0x00, 0x04
+	playPause := EvdevCodes["KEY_PLAYPAUSE"]
+	keys := map[uint16]events.Key{playPause: events.Pause}
+
+	var in bytes.Buffer
+	for _, ev := range [][]byte{
+		inputEvent(evMsc, 4, 0xc00cd),
+		inputEvent(evKey, playPause, 1),
+		inputEvent(evSyn, 0, 0),
+		inputEvent(evKey, playPause, 2),
+		inputEvent(evKey, playPause, 2),
+		inputEvent(evKey, playPause, 0),
+		// Keys that are not mapped, and values that are not known.
+		inputEvent(evKey, EvdevCodes["KEY_MUTE"], 1),
+		inputEvent(evKey, playPause, 3),
+		// Repeats count again from the next press.
+		inputEvent(evKey, playPause, 1),
+		inputEvent(evKey, playPause, 2),
+	} {
+		in.Write(ev)
+	}
+
+	ch := make(chan events.Event, 10)
+	if err := ReadEvdev(context.Background(), &in, keys, ch); err != nil {
+		t.Fatalf("ReadEvdev failed: %v", err)
+	}
+	close(ch)
+	want := []events.Event{
+		{Key: events.Pause, Gesture: events.Press},
+		{Key: events.Pause, Gesture: events.Repeat, Count: 1},
+		{Key: events.Pause, Gesture: events.Repeat, Count: 2},
+		{Key: events.Pause, Gesture: events.Release},
+		{Key: events.Pause, Gesture: events.Press},
+		{Key: events.Pause, Gesture: events.Repeat, Count: 1},
+	}
+	var got []events.Event
+	for ev := range ch {
+		got = append(got, ev)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadEvdevErrors(t *testing.T) {
+	keys := map[uint16]events.Key{EvdevCodes["KEY_PLAYPAUSE"]: events.Pause}
+
+	// A device that goes away part way through an event.
+	ev := inputEvent(evKey, EvdevCodes["KEY_PLAYPAUSE"], 1)
+	err := ReadEvdev(context.Background(), bytes.NewReader(ev[:len(ev)-1]), keys, make(chan events.Event, 1))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadEvdev of a short event = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// Nothing reads the events, and the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ReadEvdev(ctx, bytes.NewReader(ev), keys, make(chan events.Event))
+	if err != context.Canceled {
+		t.Errorf("ReadEvdev after cancelling = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	grab := []string{"BT Media Remote*", "Flirc"}
+	for _, c := range []struct {
+		name string
+		want bool
+	}{
+		{"BT Media Remote Keyboard", true},
+		{"Flirc", true},
+		{"gpio_ir_recv", false},
+		{"AT Translated Set 2 keyboard", false},
+		{"", false},
+	} {
+		if got := matchAny(grab, c.name); got != c.want {
+			t.Errorf("matchAny(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+	if matchAny(nil, "BT Media Remote") {
+		t.Errorf("matchAny with no globs matched")
+	}
+}
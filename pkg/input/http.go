@@ -0,0 +1,103 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+// HTTP accepts key presses as HTTP requests like
+//
+//	POST /key?name=ButtonUp
+//	POST /key?name=RemoteUp&gesture=Repeat
+//	POST /key?name=Volume&gesture=Set&level=40
+//
+// Without a gesture, the key is sent as a Press followed by a Release.
+type HTTP struct {
+	addr string
+
+	mu  sync.Mutex
+	srv *http.Server
+}
+
+var _ Source = (*HTTP)(nil)
+
+func NewHTTP(addr string) *HTTP {
+	return &HTTP{addr: addr}
+}
+
+func (h *HTTP) Start(ctx context.Context, ch chan<- events.Event) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/key", func(res http.ResponseWriter, req *http.Request) {
+		key, err := events.ParseKey(req.FormValue("name"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gsts := []events.Gesture{events.Press, events.Release}
+		if name := req.FormValue("gesture"); name != "" {
+			gst, err := events.ParseGesture(name)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			gsts = []events.Gesture{gst}
+		}
+		for _, gst := range gsts {
+			ev := events.Event{Key: key, Gesture: gst}
+			switch gst {
+			case events.Repeat:
+				ev.Count = 1
+			case events.Set:
+				level, err := strconv.Atoi(req.FormValue("level"))
+				if err != nil {
+					http.Error(res, "bad level", http.StatusBadRequest)
+					return
+				}
+				ev.Level = level
+			}
+			if !events.Send(req.Context(), ch, ev) {
+				return
+			}
+		}
+		fmt.Fprintln(res, "ok")
+	})
+
+	// Listen here, so that a port in use fails Start.
+	ln, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return fmt.Errorf("HTTP input: %v", err)
+	}
+	h.mu.Lock()
+	h.srv = &http.Server{Addr: h.addr, Handler: mux}
+	srv := h.srv
+	h.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP input failed: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		h.Stop()
+	}()
+	return nil
+}
+
+func (h *HTTP) Stop() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.srv == nil {
+		return nil
+	}
+	err := h.srv.Close()
+	h.srv = nil
+	return err
+}
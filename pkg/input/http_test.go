@@ -0,0 +1,43 @@
+package input
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+func TestHTTP(t *testing.T) {
+	// Find a free port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan events.Event, 2)
+	h := NewHTTP(addr)
+	if err := h.Start(ctx, ch); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer h.Stop()
+
+	resp, err := http.Post("http://"+addr+"/key?name=Volume&gesture=Set&level=40", "", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if ev := <-ch; ev != (events.Event{Key: events.Volume, Gesture: events.Set, Level: 40}) {
+		t.Errorf("got %v, want Volume Set 40", ev)
+	}
+
+	// A second source on the same port fails to start.
+	if err := NewHTTP(addr).Start(ctx, ch); err == nil {
+		t.Errorf("Start on a port in use succeeded")
+	}
+}
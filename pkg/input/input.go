@@ -0,0 +1,93 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/button"
+	"github.com/nlacasse/boss-radio/pkg/config"
+	"github.com/nlacasse/boss-radio/pkg/events"
+	"github.com/nlacasse/boss-radio/pkg/remote"
+)
+
+// Source is a source of input events, like the buttons or the IR remote.
+type Source interface {
+	// Start starts sending events on ch. It returns once the source is
+	// running, and keeps sending until ctx is done or Stop is called.
+	Start(ctx context.Context, ch chan<- events.Event) error
+
+	// Stop stops sending events and releases any handles the source holds.
+	// It is safe to call more than once.
+	Stop() error
+}
+
+var (
+	_ Source = (*button.Button)(nil)
+	_ Source = (*remote.Remote)(nil)
+)
+
+// FromConfig returns the sources named in cfg.Inputs.
+func FromConfig(cfg *config.Config) ([]Source, error) {
+	var srcs []Source
+	for _, typ := range cfg.Inputs {
+		switch typ {
+		case "gpio":
+			pins, err := cfg.ButtonPins()
+			if err != nil {
+				return nil, err
+			}
+			srcs = append(srcs, button.New(button.Options{
+				Pins:        pins,
+				LongPress:   time.Duration(cfg.LongPress),
+				DoublePress: time.Duration(cfg.DoublePress),
+			}))
+		case "encoder":
+			dials, err := cfg.DialEncoders()
+			if err != nil {
+				return nil, err
+			}
+			for key, enc := range dials {
+				srcs = append(srcs, NewEncoder(key, EncoderOptions{
+					A:              enc.A,
+					B:              enc.B,
+					Switch:         enc.Switch,
+					StepsPerDetent: enc.StepsPerDetent,
+				}))
+			}
+		case "lirc":
+			keys, err := cfg.RemoteKeys()
+			if err != nil {
+				return nil, err
+			}
+			srcs = append(srcs, remote.New(keys))
+		case "evdev":
+			names, err := cfg.EvdevKeys()
+			if err != nil {
+				return nil, err
+			}
+			keys := make(map[uint16]events.Key)
+			for name, key := range names {
+				code, ok := EvdevCodes[name]
+				if !ok {
+					log.Printf("evdev: ignoring unknown key %q", name)
+					continue
+				}
+				keys[code] = key
+			}
+			srcs = append(srcs, NewEvdev(cfg.EvdevDevices, cfg.EvdevGrab, keys))
+		case "keyboard":
+			keys, err := cfg.KeyboardKeys()
+			if err != nil {
+				return nil, err
+			}
+			srcs = append(srcs, NewKeyboard(keys))
+		case "http":
+			srcs = append(srcs, NewHTTP(cfg.HTTPInput))
+		default:
+			return nil, fmt.Errorf("unknown input type %q", typ)
+		}
+	}
+	return srcs, nil
+}
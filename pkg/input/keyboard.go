@@ -0,0 +1,79 @@
+package input
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nlacasse/boss-radio/pkg/events"
+)
+
+// Keyboard reads key presses from the terminal on stdin. Each mapped
+// character is sent as a Press followed by a Release.
+type Keyboard struct {
+	keys map[rune]events.Key
+
+	mu  sync.Mutex
+	old *unix.Termios
+}
+
+var _ Source = (*Keyboard)(nil)
+
+func NewKeyboard(keys map[rune]events.Key) *Keyboard {
+	return &Keyboard{keys: keys}
+}
+
+func (k *Keyboard) Start(ctx context.Context, ch chan<- events.Event) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Turn off line buffering and echo, so that keys are read as soon as
+	// they are typed. If stdin is not a terminal keys are read as they come.
+	fd := int(os.Stdin.Fd())
+	if old, err := unix.IoctlGetTermios(fd, unix.TCGETS); err == nil {
+		raw := *old
+		raw.Lflag &^= unix.ICANON | unix.ECHO
+		raw.Cc[unix.VMIN] = 1
+		raw.Cc[unix.VTIME] = 0
+		if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+			return err
+		}
+		k.old = old
+	}
+
+	go func() {
+		defer k.Stop()
+		r := bufio.NewReader(os.Stdin)
+		for {
+			c, _, err := r.ReadRune()
+			if err != nil || ctx.Err() != nil {
+				return
+			}
+			key, ok := k.keys[c]
+			if !ok {
+				continue
+			}
+			if !events.Send(ctx, ch, events.Event{Key: key, Gesture: events.Press}) ||
+				!events.Send(ctx, ch, events.Event{Key: key, Gesture: events.Release}) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop restores the terminal. A pending read of stdin can not be
+// interrupted, so the reader exits after the next key.
+func (k *Keyboard) Stop() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.old == nil {
+		return nil
+	}
+	err := unix.IoctlSetTermios(int(os.Stdin.Fd()), unix.TCSETS, k.old)
+	k.old = nil
+	return err
+}
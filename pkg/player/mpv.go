@@ -0,0 +1,393 @@
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stallTimeout is how long mpv can wait for data before the stream counts
+// as stalled.
+const stallTimeout = 15 * time.Second
+
+// meterInterval is how often the loudness is read from mpv.
+const meterInterval = time.Second
+
+// ipcTimeout is how long to wait for mpv to open its IPC socket, and for it
+// to answer a command.
+const ipcTimeout = 3 * time.Second
+
+var mpvCount int64
+
+// normalizeFilters are the lavfi filters for each normalization option.
+var normalizeFilters = map[string]string{
+	"loudnorm":   "loudnorm=I=-16:TP=-1.5:LRA=11",
+	"dynaudnorm": "dynaudnorm",
+}
+
+// meterLabel labels the ebur128 filter that measures the stream's loudness.
+const meterLabel = "meter"
+
+// mpv plays a URL with mpv, and controls it over its JSON IPC socket.
+type mpv struct {
+	url      string
+	playlist []string
+	start    time.Duration
+	open     func() (io.ReadCloser, error)
+	// in is the stream that mpv reads from its stdin, if open is set.
+	in   io.ReadCloser
+	opts Options
+	sock string
+	cmd  *exec.Cmd
+	// exited is closed, with waitErr set, once mpv exits.
+	exited  chan struct{}
+	waitErr error
+	// stallSince is when mpv was first seen waiting for data, and
+	// rebuffers how many times it has been seen starting to.
+	stallSince time.Time
+	rebuffers  int
+
+	// lufs is the loudness last read from mpv, by a goroutine so that
+	// Loudness never waits for mpv.
+	lmu     sync.Mutex
+	lufs    float64
+	lufsErr error
+
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID int
+}
+
+func newMpv(s Stream, opts Options) *mpv {
+	n := atomic.AddInt64(&mpvCount, 1)
+	return &mpv{
+		url:      s.URL,
+		playlist: s.Playlist,
+		start:    s.Start,
+		open:     s.Open,
+		opts:     opts,
+		sock:     filepath.Join(os.TempDir(), fmt.Sprintf("boss-radio-mpv-%d-%d.sock", os.Getpid(), n)),
+	}
+}
+
+func (m *mpv) Start() error {
+	var af []string
+	if m.metered() {
+		// Measure the loudness of the stream as it comes in, before any
+		// normalization.
+		af = append(af, fmt.Sprintf("@%s:lavfi=[ebur128=metadata=1]", meterLabel))
+	}
+	if m.opts.Normalize != "" {
+		f, ok := normalizeFilters[m.opts.Normalize]
+		if !ok {
+			return fmt.Errorf("unknown normalization %q", m.opts.Normalize)
+		}
+		af = append(af, "lavfi=["+f+"]")
+	}
+	args := []string{"-no-video", "--input-ipc-server=" + m.sock}
+	if len(af) > 0 {
+		args = append(args, "--af="+strings.Join(af, ","))
+	}
+	if dev := m.opts.Device; dev != "" {
+		// mpv names devices by audio output, like "alsa/hw:1,0".
+		if !strings.Contains(dev, "/") {
+			dev = "alsa/" + dev
+		}
+		args = append(args, "--audio-device="+dev)
+	}
+	if m.start > 0 {
+		args = append(args, fmt.Sprintf("--start=%.1f", m.start.Seconds()))
+	}
+	url := m.url
+	if len(m.playlist) > 0 {
+		// Pass the playlist as a file, since it may be too long for the
+		// command line.
+		pl := strings.TrimSuffix(m.sock, ".sock") + ".m3u"
+		if err := os.WriteFile(pl, []byte(strings.Join(m.playlist, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+		args = append(args, "--loop-playlist=inf", "--playlist="+pl)
+		m.cmd = exec.Command("mpv", args...)
+		return m.run()
+	}
+	if m.open != nil {
+		in, err := m.open()
+		if err != nil {
+			return err
+		}
+		m.in = in
+		url = "-"
+	}
+	m.cmd = exec.Command("mpv", append(args, url)...)
+	m.cmd.Stdin = m.in
+	return m.run()
+}
+
+// run starts mpv, and watches for it exiting.
+func (m *mpv) run() error {
+	if err := m.cmd.Start(); err != nil {
+		return err
+	}
+	m.exited = make(chan struct{})
+	go func() {
+		m.waitErr = m.cmd.Wait()
+		close(m.exited)
+	}()
+	if m.metered() {
+		go m.meter()
+	}
+	return nil
+}
+
+// metered returns true if the stream's loudness is measured.
+func (m *mpv) metered() bool {
+	return m.opts.Meter || m.opts.Normalize != ""
+}
+
+// meter reads the loudness from mpv until it exits.
+func (m *mpv) meter() {
+	t := time.NewTicker(meterInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.exited:
+			return
+		case <-t.C:
+		}
+		lufs, err := m.readLoudness()
+		m.lmu.Lock()
+		m.lufs, m.lufsErr = lufs, err
+		m.lmu.Unlock()
+	}
+}
+
+func (m *mpv) Stop() error {
+	m.mu.Lock()
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+	m.mu.Unlock()
+	// Close the stream first: waiting for mpv also waits for the copy to its
+	// stdin, which is stuck reading until the stream gives more data.
+	if m.in != nil {
+		m.in.Close()
+	}
+	var err error
+	if m.exited != nil {
+		err = m.cmd.Process.Kill()
+		if errors.Is(err, os.ErrProcessDone) {
+			err = nil
+		}
+		<-m.exited
+	}
+	os.Remove(m.sock)
+	if len(m.playlist) > 0 {
+		os.Remove(strings.TrimSuffix(m.sock, ".sock") + ".m3u")
+	}
+	return err
+}
+
+func (m *mpv) SetPaused(paused bool) error {
+	_, err := m.command("set_property", "pause", paused)
+	return err
+}
+
+// Loudness returns the loudness last read from mpv, without waiting for it.
+func (m *mpv) Loudness() (float64, error) {
+	if !m.metered() {
+		return 0, ErrNotSupported
+	}
+	m.lmu.Lock()
+	defer m.lmu.Unlock()
+	if m.lufs == 0 && m.lufsErr == nil {
+		return 0, fmt.Errorf("no loudness measured yet")
+	}
+	return m.lufs, m.lufsErr
+}
+
+func (m *mpv) readLoudness() (float64, error) {
+	data, err := m.command("get_property", "af-metadata/"+meterLabel)
+	if err != nil {
+		return 0, err
+	}
+	var md map[string]string
+	if err := json.Unmarshal(data, &md); err != nil {
+		return 0, err
+	}
+	s, ok := md["lavfi.r128.S"]
+	if !ok {
+		return 0, fmt.Errorf("no loudness measured yet")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (m *mpv) Next() error {
+	_, err := m.command("playlist-next", "force")
+	return err
+}
+
+func (m *mpv) Prev() error {
+	_, err := m.command("playlist-prev", "force")
+	return err
+}
+
+func (m *mpv) Pos() (int, error) {
+	data, err := m.command("get_property", "playlist-pos")
+	if err != nil {
+		return 0, err
+	}
+	var pos int
+	err = json.Unmarshal(data, &pos)
+	return pos, err
+}
+
+func (m *mpv) Position() (time.Duration, time.Duration, error) {
+	pos, err := m.seconds("time-pos")
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := m.seconds("duration")
+	if err != nil {
+		return 0, 0, err
+	}
+	return pos, length, nil
+}
+
+func (m *mpv) Err() error {
+	select {
+	case <-m.exited:
+		return fmt.Errorf("mpv exited: %v", m.waitErr)
+	default:
+	}
+	data, err := m.command("get_property", "paused-for-cache")
+	if err != nil {
+		// mpv may not be ready to answer yet.
+		return nil
+	}
+	var waiting bool
+	if err := json.Unmarshal(data, &waiting); err != nil || !waiting {
+		m.stallSince = time.Time{}
+		return nil
+	}
+	if m.stallSince.IsZero() {
+		m.stallSince = time.Now()
+		m.rebuffers++
+	}
+	if time.Since(m.stallSince) > stallTimeout {
+		return ErrStalled
+	}
+	return nil
+}
+
+func (m *mpv) Rebuffers() int {
+	n := m.rebuffers
+	m.rebuffers = 0
+	return n
+}
+
+func (m *mpv) Seek(d time.Duration) error {
+	_, err := m.command("seek", d.Seconds(), "relative")
+	return err
+}
+
+// seconds returns a property that mpv gives in seconds, like "duration".
+func (m *mpv) seconds(prop string) (time.Duration, error) {
+	data, err := m.command("get_property", prop)
+	if err != nil {
+		return 0, err
+	}
+	var secs float64
+	if err := json.Unmarshal(data, &secs); err != nil {
+		return 0, err
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+type mpvRequest struct {
+	Command   []interface{} `json:"command"`
+	RequestID int           `json:"request_id"`
+}
+
+type mpvResponse struct {
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+	RequestID int             `json:"request_id"`
+	Event     string          `json:"event"`
+}
+
+// command runs an mpv command, like "set_property", and returns its data.
+func (m *mpv) command(args ...interface{}) (json.RawMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.connectLocked(); err != nil {
+		return nil, err
+	}
+
+	m.nextID++
+	req := mpvRequest{Command: args, RequestID: m.nextID}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	m.conn.SetDeadline(time.Now().Add(ipcTimeout))
+	if _, err := m.conn.Write(append(data, '\n')); err != nil {
+		m.conn.Close()
+		m.conn = nil
+		return nil, err
+	}
+
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if err != nil {
+			m.conn.Close()
+			m.conn = nil
+			return nil, err
+		}
+		var res mpvResponse
+		if err := json.Unmarshal(line, &res); err != nil {
+			return nil, err
+		}
+		// Skip events and replies to earlier commands that timed out.
+		if res.Event != "" || res.RequestID != req.RequestID {
+			continue
+		}
+		if res.Error != "success" {
+			return nil, fmt.Errorf("mpv %v: %s", args, res.Error)
+		}
+		return res.Data, nil
+	}
+}
+
+// connectLocked connects to mpv's IPC socket, waiting for mpv to create it.
+func (m *mpv) connectLocked() error {
+	if m.conn != nil {
+		return nil
+	}
+	deadline := time.Now().Add(ipcTimeout)
+	for {
+		conn, err := net.Dial("unix", m.sock)
+		if err == nil {
+			m.conn = conn
+			m.r = bufio.NewReader(conn)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("connecting to mpv: %w", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
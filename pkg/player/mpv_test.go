@@ -0,0 +1,36 @@
+package player
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMpvStopStalledStream checks that Stop returns while the stream that
+// mpv reads has nothing more to give.
+func TestMpvStopStalledStream(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mpv"), []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	m := newMpv(Stream{Open: func() (io.ReadCloser, error) { return pr, nil }}, Options{})
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	stopped := make(chan error)
+	go func() { stopped <- m.Stop() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Stop failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
@@ -0,0 +1,366 @@
+package player
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// nativeStartTimeout is how long Start waits for the stream to start
+// playing before leaving it to carry on in the background.
+const nativeStartTimeout = 10 * time.Second
+
+// nativeRebuffer is how long a read from the stream must block to count as
+// a rebuffer.
+const nativeRebuffer = 2 * time.Second
+
+// nativeBuffer is how much of the stream the native player reads ahead of
+// the decoder, in bytes. At 128kbps this is about 8 seconds.
+const nativeBuffer = 128 << 10
+
+// native fetches and decodes a stream in-process, and writes the PCM to
+// ALSA through aplay. Only MP3 streams are supported, since there is no
+// pure-Go AAC decoder.
+type native struct {
+	url  string
+	open func() (io.ReadCloser, error)
+	opts Options
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	paused  bool
+	stopped bool
+	title   string
+	// body is the stream being read, closed by Stop to unblock reads that
+	// the context does not, like those of streams from Open.
+	body io.Closer
+	// err is why playing stopped, once done is closed.
+	err error
+	// lastRead is when data last came from the stream, and rebuffers how
+	// many slow reads there have been since Rebuffers was last called.
+	lastRead  time.Time
+	rebuffers int
+}
+
+var _ Player = (*native)(nil)
+var _ Monitor = (*native)(nil)
+
+// nativePlays returns false for streams that are plainly not MP3, like the
+// AAC streams that KFJC and WFMU play first, which are left to mpv.
+func nativePlays(s Stream) bool {
+	if s.Open != nil {
+		return true
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return true
+	}
+	p := strings.ToLower(u.Path)
+	for _, s := range []string{"aac", ".m4a", ".ogg", ".opus", ".flac", ".m3u8"} {
+		if strings.Contains(p, s) {
+			log.Printf("native player can not play %s, using mpv", u)
+			return false
+		}
+	}
+	return true
+}
+
+func newNative(s Stream, opts Options) *native {
+	n := &native{url: s.URL, open: s.Open, opts: opts}
+	n.cond = sync.NewCond(&n.mu)
+	return n
+}
+
+// Start returns once the stream is playing, or an error if the stream,
+// decoder or aplay fail to start. Streams slow to start carry on in the
+// background, and report failures through Err.
+func (n *native) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.done = make(chan struct{})
+	playing := make(chan struct{})
+	go func() {
+		err := n.run(ctx, playing)
+		if err == nil {
+			err = io.EOF
+		}
+		if ctx.Err() == nil {
+			log.Printf("native player %s: %v", n.url, err)
+		}
+		n.mu.Lock()
+		n.err = err
+		n.mu.Unlock()
+		close(n.done)
+	}()
+	select {
+	case <-playing:
+	case <-n.done:
+		cancel()
+		return n.err
+	case <-time.After(nativeStartTimeout):
+	}
+	return nil
+}
+
+// run plays the stream, closing playing once it has started.
+func (n *native) run(ctx context.Context, playing chan<- struct{}) error {
+	r, err := n.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n.mu.Lock()
+	n.body = r
+	stopped := n.stopped
+	n.mu.Unlock()
+	if stopped {
+		return nil
+	}
+	dec, err := mp3.NewDecoder(bufio.NewReaderSize(r, nativeBuffer))
+	if err != nil {
+		return fmt.Errorf("mp3.NewDecoder failed: %v", err)
+	}
+
+	// go-mp3 always decodes to 16 bit stereo.
+	args := []string{"-q", "-t", "raw", "-f", "S16_LE", "-c", "2", "-r", strconv.Itoa(dec.SampleRate())}
+	if n.opts.Device != "" {
+		args = append(args, "-D", n.opts.Device)
+	}
+	aplay := exec.CommandContext(ctx, "aplay", args...)
+	out, err := aplay.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := aplay.Start(); err != nil {
+		return fmt.Errorf("starting aplay failed: %v", err)
+	}
+	defer aplay.Wait()
+	defer out.Close()
+	close(playing)
+
+	buf := make([]byte, 4096)
+	for {
+		if !n.waitUnpaused() {
+			return nil
+		}
+		start := time.Now()
+		nr, err := dec.Read(buf)
+		n.mu.Lock()
+		if time.Since(start) > nativeRebuffer {
+			n.rebuffers++
+		}
+		if nr > 0 {
+			n.lastRead = time.Now()
+		}
+		n.mu.Unlock()
+		if nr > 0 {
+			if _, werr := out.Write(buf[:nr]); werr != nil {
+				return fmt.Errorf("writing to aplay failed: %v", werr)
+			}
+		}
+		if err == io.EOF {
+			return fmt.Errorf("stream ended")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fetch opens the stream, either from the station or over HTTP.
+func (n *native) fetch(ctx context.Context) (io.ReadCloser, error) {
+	if n.open != nil {
+		return n.open()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", n.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Ask for in-band ICY metadata, for the stream title.
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET failed: %s", resp.Status)
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch ct {
+	case "audio/mpeg", "audio/mp3", "audio/mpeg3", "":
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("the native player only plays MP3, not %q", ct)
+	}
+	if metaint, err := strconv.Atoi(resp.Header.Get("Icy-Metaint")); err == nil && metaint > 0 {
+		ir := &icyReader{r: resp.Body, metaint: metaint, left: metaint, onTitle: n.setTitle}
+		return struct {
+			io.Reader
+			io.Closer
+		}{ir, resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
+// waitUnpaused blocks while the player is paused. It returns false once the
+// player is stopped.
+func (n *native) waitUnpaused() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for n.paused && !n.stopped {
+		n.cond.Wait()
+	}
+	if !n.stopped {
+		// Time spent paused is not a stall.
+		n.lastRead = time.Now()
+	}
+	return !n.stopped
+}
+
+func (n *native) Stop() error {
+	n.mu.Lock()
+	n.stopped = true
+	n.cond.Broadcast()
+	body := n.body
+	n.mu.Unlock()
+	if n.cancel == nil {
+		return nil
+	}
+	n.cancel()
+	if body != nil {
+		body.Close()
+	}
+	<-n.done
+	return nil
+}
+
+// Err reports the stream, decoder or aplay stopping, and streams that have
+// sent nothing for too long.
+func (n *native) Err() error {
+	select {
+	case <-n.done:
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return fmt.Errorf("native player exited: %v", n.err)
+	default:
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.paused && !n.lastRead.IsZero() && time.Since(n.lastRead) > stallTimeout {
+		return ErrStalled
+	}
+	return nil
+}
+
+func (n *native) Rebuffers() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	r := n.rebuffers
+	n.rebuffers = 0
+	return r
+}
+
+// SetPaused stops reading the stream while paused. A live stream picks up
+// where it left off, as long as the server keeps the connection open.
+func (n *native) SetPaused(paused bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.paused = paused
+	n.cond.Broadcast()
+	return nil
+}
+
+func (n *native) Loudness() (float64, error) {
+	return 0, ErrNotSupported
+}
+
+// StreamTitle returns the title from the stream's ICY metadata, if any.
+func (n *native) StreamTitle() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.title
+}
+
+func (n *native) setTitle(title string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.title = title
+}
+
+// icyReader strips the ICY metadata blocks that Shoutcast and Icecast
+// servers put every metaint bytes of audio.
+type icyReader struct {
+	r       io.Reader
+	metaint int
+	left    int
+	onTitle func(string)
+}
+
+func (ir *icyReader) Read(p []byte) (int, error) {
+	if ir.left == 0 {
+		if err := ir.readMeta(); err != nil {
+			return 0, err
+		}
+		ir.left = ir.metaint
+	}
+	if len(p) > ir.left {
+		p = p[:ir.left]
+	}
+	n, err := ir.r.Read(p)
+	ir.left -= n
+	return n, err
+}
+
+func (ir *icyReader) readMeta() error {
+	var lb [1]byte
+	if _, err := io.ReadFull(ir.r, lb[:]); err != nil {
+		return err
+	}
+	if lb[0] == 0 {
+		return nil
+	}
+	meta := make([]byte, int(lb[0])*16)
+	if _, err := io.ReadFull(ir.r, meta); err != nil {
+		return err
+	}
+	if title, ok := ParseStreamTitle(string(meta)); ok && ir.onTitle != nil {
+		ir.onTitle(title)
+	}
+	return nil
+}
+
+// ParseStreamTitle returns the StreamTitle from an ICY metadata block like
+// "StreamTitle='Artist - Track';".
+func ParseStreamTitle(meta string) (string, bool) {
+	const key = "StreamTitle='"
+	i := strings.Index(meta, key)
+	if i < 0 {
+		return "", false
+	}
+	rest := meta[i+len(key):]
+	// Titles can contain quotes, so look for the end of the field.
+	j := strings.Index(rest, "';")
+	if j < 0 {
+		j = strings.LastIndex(rest, "'")
+	}
+	if j < 0 {
+		return "", false
+	}
+	return rest[:j], true
+}
@@ -0,0 +1,47 @@
+package player
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNativePlays(t *testing.T) {
+	for _, c := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/stream.mp3", true},
+		{"https://example.com/stream", true},
+		{"https://example.com/freeform-128k", true},
+		{"https://example.com/kfjc-320k-aac", false},
+		{"https://example.com/freeform-high.aac", false},
+		{"https://example.com/live.m3u8?token=x", false},
+		{"https://example.com/stream.OGG", false},
+	} {
+		if got := nativePlays(Stream{URL: c.url}); got != c.want {
+			t.Errorf("nativePlays(%s) = %v, want %v", c.url, got, c.want)
+		}
+	}
+}
+
+func TestNativeStartFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/aac")
+		w.Write([]byte("not mp3"))
+	}))
+	defer srv.Close()
+
+	n := newNative(Stream{URL: srv.URL}, Options{})
+	err := n.Start()
+	if err == nil || !strings.Contains(err.Error(), "only plays MP3") {
+		t.Errorf("Start = %v, want an error about MP3", err)
+	}
+	if err := n.Err(); err == nil {
+		t.Errorf("Err after a failed Start = nil")
+	}
+	if err := n.Stop(); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+}
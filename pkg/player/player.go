@@ -0,0 +1,191 @@
+package player
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNotSupported is returned by players that can not do what was asked,
+// like pausing a Bluetooth stream.
+var ErrNotSupported = errors.New("not supported by this player")
+
+// ErrStalled is returned by players whose stream stopped sending data.
+var ErrStalled = errors.New("stream stalled")
+
+// Player plays a single stream.
+type Player interface {
+	// Start starts playing.
+	Start() error
+
+	// Stop stops playing and releases the player's resources.
+	Stop() error
+
+	// SetPaused pauses or resumes playback.
+	SetPaused(paused bool) error
+
+	// Loudness returns the short-term loudness of the stream, in LUFS.
+	Loudness() (float64, error)
+}
+
+// Options holds settings that apply to a player, rather than to a stream.
+type Options struct {
+	// Normalize names the loudness normalization filter to use, either
+	// "loudnorm" for EBU R128 normalization or "dynaudnorm" for dynamic
+	// normalization. It is empty for none.
+	Normalize string
+
+	// Meter measures the stream's loudness, for Loudness. Normalize turns
+	// it on too.
+	Meter bool
+
+	// Backend is the player to use for URL streams: "mpv", the default, or
+	// "native" to decode MP3 streams in-process.
+	Backend string
+
+	// Device is the ALSA device to play to, like "hw:CARD=sndrpihifiberry"
+	// or "plughw:1,0". It is empty for the default device.
+	Device string
+}
+
+// Stream describes what a station plays.
+type Stream struct {
+	// URL is the stream to play with mpv.
+	URL string
+
+	// Sources are the URLs the stream can be played from, best first, if
+	// there is more than one. URL is the first of them.
+	Sources []Source
+
+	// Cmd, if set, is run to play the station instead, e.g. for sources
+	// that are not a URL.
+	Cmd []string
+	// Playlist, if set, is a list of files or URLs to play in turn instead
+	// of URL. Only mpv plays playlists.
+	Playlist []string
+
+	// Start is how far into URL to start playing, for files that are
+	// resumed, like podcast episodes. Only mpv starts part way through.
+	Start time.Duration
+
+	// Open, if set, returns the stream's bytes, for sources like HLS that
+	// are fetched by the station rather than the player.
+	Open func() (io.ReadCloser, error)
+
+	// DeviceFlag is the flag that Cmd takes an ALSA device with, like
+	// "--pcm". If empty, Cmd always plays to its default device.
+	DeviceFlag string
+}
+
+// Source is one of the URLs that a stream can be played from.
+type Source struct {
+	URL string
+	// Bitrate is in kbps, or 0 if unknown.
+	Bitrate int
+}
+
+// FromSources returns a stream playing the first of srcs, which falls back to
+// the others.
+func FromSources(srcs ...Source) Stream {
+	return Stream{URL: srcs[0].URL, Sources: srcs}
+}
+
+// Live reports whether s is a stream fetched over the network, rather than a
+// command, playlist or local file.
+func (s Stream) Live() bool {
+	if len(s.Cmd) > 0 || len(s.Playlist) > 0 {
+		return false
+	}
+	return s.Open != nil || strings.HasPrefix(s.URL, "http://") || strings.HasPrefix(s.URL, "https://")
+}
+
+// New returns a player for s.
+func New(s Stream, opts Options) Player {
+	if len(s.Cmd) > 0 {
+		args := s.Cmd
+		if s.DeviceFlag != "" && opts.Device != "" {
+			args = append(append([]string(nil), s.Cmd...), s.DeviceFlag+"="+opts.Device)
+		}
+		return &cmdPlayer{args: args}
+	}
+	if opts.Backend == "native" && s.Live() && nativePlays(s) {
+		return newNative(s, opts)
+	}
+	return newMpv(s, opts)
+}
+
+// Playlister is implemented by players that can skip around a playlist.
+type Playlister interface {
+	Next() error
+	Prev() error
+	// Pos returns the index in the playlist of what is playing.
+	Pos() (int, error)
+}
+
+// Positioner is implemented by players that know how far through what they
+// play they are.
+type Positioner interface {
+	// Position returns the position in, and length of, what is playing.
+	Position() (pos, length time.Duration, err error)
+}
+
+// Seeker is implemented by players that can move through what they play.
+type Seeker interface {
+	// Seek moves forward by d, or back if d is negative.
+	Seek(d time.Duration) error
+}
+
+// Monitor is implemented by players that can tell when playback has failed.
+type Monitor interface {
+	// Err returns why playback has failed or stalled, or nil if it has not.
+	Err() error
+
+	// Rebuffers returns how many times playback stopped to wait for data
+	// since it was last called.
+	Rebuffers() int
+}
+
+// Titler is implemented by players that read the title of what is playing
+// from the stream itself.
+type Titler interface {
+	StreamTitle() string
+}
+
+// cmdPlayer runs a command that plays audio by itself.
+type cmdPlayer struct {
+	args []string
+	cmd  *exec.Cmd
+}
+
+func (p *cmdPlayer) Start() error {
+	p.cmd = exec.Command(p.args[0], p.args[1:]...)
+	return p.cmd.Start()
+}
+
+func (p *cmdPlayer) Stop() error {
+	return kill(p.cmd)
+}
+
+func (p *cmdPlayer) SetPaused(bool) error {
+	return ErrNotSupported
+}
+
+func (p *cmdPlayer) Loudness() (float64, error) {
+	return 0, ErrNotSupported
+}
+
+// kill kills cmd and waits for it to exit.
+func kill(cmd *exec.Cmd) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	if err := cmd.Process.Signal(syscall.SIGKILL); err != nil {
+		return err
+	}
+	// Wait reports the kill as an error, which is expected.
+	cmd.Wait()
+	return nil
+}
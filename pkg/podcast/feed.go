@@ -0,0 +1,160 @@
+package podcast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Feed is a parsed RSS or Atom podcast feed.
+type Feed struct {
+	Title string
+	// Episodes are newest first.
+	Episodes []Episode
+}
+
+// Episode is an episode of a podcast.
+type Episode struct {
+	// GUID identifies the episode. It is the episode's URL if the feed
+	// gives no ID.
+	GUID      string
+	Title     string
+	URL       string
+	Published time.Time
+}
+
+type rss struct {
+	Title string    `xml:"channel>title"`
+	Items []rssItem `xml:"channel>item"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+type atom struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Links     []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+// ParseFeed parses an RSS 2.0 or Atom feed. Items without audio are left out.
+func ParseFeed(data []byte) (*Feed, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Feed
+	switch root {
+	case "rss":
+		var r rss
+		if err := xml.Unmarshal(data, &r); err != nil {
+			return nil, err
+		}
+		f.Title = strings.TrimSpace(r.Title)
+		for _, it := range r.Items {
+			if it.Enclosure.URL == "" {
+				continue
+			}
+			f.Episodes = append(f.Episodes, Episode{
+				GUID:      strings.TrimSpace(it.GUID),
+				Title:     strings.TrimSpace(it.Title),
+				URL:       it.Enclosure.URL,
+				Published: parseDate(it.PubDate),
+			})
+		}
+	case "feed":
+		var a atom
+		if err := xml.Unmarshal(data, &a); err != nil {
+			return nil, err
+		}
+		f.Title = strings.TrimSpace(a.Title)
+		for _, e := range a.Entries {
+			ep := Episode{
+				GUID:      strings.TrimSpace(e.ID),
+				Title:     strings.TrimSpace(e.Title),
+				Published: parseDate(e.Published),
+			}
+			if ep.Published.IsZero() {
+				ep.Published = parseDate(e.Updated)
+			}
+			for _, l := range e.Links {
+				if l.Rel == "enclosure" {
+					ep.URL = l.Href
+					break
+				}
+			}
+			if ep.URL == "" {
+				continue
+			}
+			f.Episodes = append(f.Episodes, ep)
+		}
+	default:
+		return nil, fmt.Errorf("not a feed: <%s>", root)
+	}
+
+	for i := range f.Episodes {
+		if f.Episodes[i].GUID == "" {
+			f.Episodes[i].GUID = f.Episodes[i].URL
+		}
+	}
+	sort.SliceStable(f.Episodes, func(i, j int) bool {
+		return f.Episodes[i].Published.After(f.Episodes[j].Published)
+	})
+	return &f, nil
+}
+
+// rootElement returns the name of the document's root element.
+func rootElement(data []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("not a feed: %v", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+// dateLayouts are the date formats seen in feeds. RSS should use RFC 822
+// dates, but many feeds get them slightly wrong.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+// parseDate parses a feed date, returning the zero time if it can not.
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
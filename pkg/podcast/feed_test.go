@@ -0,0 +1,99 @@
+package podcast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	for _, c := range []struct {
+		file string
+		want Feed
+	}{
+		{
+			file: "feed.rss",
+			want: Feed{
+				Title: "Radio Show",
+				Episodes: []Episode{
+					{GUID: "show-3", Title: "Episode 3", URL: "/audio/ep3.mp3", Published: date("2024-03-12T10:00:00Z")},
+					{GUID: "show-2", Title: "Episode 2", URL: "/audio/ep2.mp3", Published: date("2024-03-05T10:00:00Z")},
+					// Without a GUID, the URL stands in for one.
+					{GUID: "/audio/ep1.mp3", Title: "Episode 1", URL: "/audio/ep1.mp3", Published: date("2024-02-27T10:00:00Z")},
+				},
+			},
+		},
+		{
+			file: "feed.atom",
+			want: Feed{
+				Title: "Atom Show",
+				Episodes: []Episode{
+					{GUID: "urn:atom:2", Title: "Newer", URL: "newer.ogg", Published: date("2024-03-08T08:00:00Z")},
+					// Updated stands in for a missing published date.
+					{GUID: "urn:atom:1", Title: "Older", URL: "https://example.com/older.mp3", Published: date("2024-03-01T09:00:00Z")},
+				},
+			},
+		},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := ParseFeed(data)
+		if err != nil {
+			t.Errorf("ParseFeed(%s) failed: %v", c.file, err)
+			continue
+		}
+		if f.Title != c.want.Title {
+			t.Errorf("%s: Title = %q, want %q", c.file, f.Title, c.want.Title)
+		}
+		if len(f.Episodes) != len(c.want.Episodes) {
+			t.Errorf("%s: Episodes = %+v, want %+v", c.file, f.Episodes, c.want.Episodes)
+			continue
+		}
+		for i, ep := range f.Episodes {
+			want := c.want.Episodes[i]
+			if ep.GUID != want.GUID || ep.Title != want.Title || ep.URL != want.URL || !ep.Published.Equal(want.Published) {
+				t.Errorf("%s: Episodes[%d] = %+v, want %+v", c.file, i, ep, want)
+			}
+		}
+	}
+}
+
+func TestParseFeedErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"not xml",
+		"<html><body>Moved</body></html>",
+	} {
+		if _, err := ParseFeed([]byte(data)); err == nil {
+			t.Errorf("ParseFeed(%q) succeeded", data)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	for _, s := range []string{
+		"Tue, 05 Mar 2024 10:00:00 +0000",
+		"Tue, 5 Mar 2024 10:00:00 +0000",
+		"5 Mar 2024 10:00:00 +0000",
+		" Tue, 05 Mar 2024 11:00:00 +0100 ",
+		"2024-03-05T10:00:00Z",
+	} {
+		if got := parseDate(s); !got.Equal(want) {
+			t.Errorf("parseDate(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if got := parseDate("last Tuesday"); !got.IsZero() {
+		t.Errorf("parseDate of junk = %v, want zero", got)
+	}
+}
@@ -0,0 +1,342 @@
+// Package podcast plays podcasts, downloading new episodes in the background.
+package podcast
+
+import (
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+//go:embed images/podcast.gif
+var logoBytes []byte
+
+// playedMargin is how close to the end an episode must get to count as
+// played. It is longer than the time between position updates, since the
+// player exits at the end without a last update.
+const playedMargin = time.Minute
+
+// episodeState is what is known about an episode. The states of all
+// episodes are kept in a JSON file in the podcast directory.
+type episodeState struct {
+	Feed      string    `json:"feed"`
+	Show      string    `json:"show"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Published time.Time `json:"published"`
+	// File is the name of the downloaded episode in the podcast
+	// directory. It is empty until the episode is downloaded.
+	File     string        `json:"file,omitempty"`
+	Position time.Duration `json:"position"`
+	Played   bool          `json:"played"`
+}
+
+// Station plays the newest unplayed episode of a set of podcasts. It
+// downloads new episodes in the background, keeping only the newest few of
+// each podcast, and remembers how far through each episode it got.
+type Station struct {
+	feeds   []string
+	dir     string
+	keep    int
+	refresh time.Duration
+	logo    image.Image
+
+	mu sync.Mutex
+	// eps are the episodes by GUID.
+	eps map[string]*episodeState
+	// cur is the GUID of the episode playing, if any.
+	cur string
+}
+
+var _ station.Station = (*Station)(nil)
+var _ station.Resumer = (*Station)(nil)
+var _ station.Local = (*Station)(nil)
+
+// New returns a station playing the podcasts with the given feed URLs. It
+// keeps its downloads in dir, keeps the newest keep episodes of each
+// podcast, and checks the feeds every refresh.
+func New(feeds []string, dir string, keep int, refresh time.Duration) *Station {
+	logo, _, err := image.Decode(bytes.NewReader(logoBytes))
+	if err != nil {
+		log.Fatalf("Could not decode Podcasts logo: %v", err)
+	}
+
+	p := &Station{
+		feeds:   feeds,
+		dir:     dir,
+		keep:    keep,
+		refresh: refresh,
+		logo:    logo,
+		eps:     make(map[string]*episodeState),
+	}
+	if err := p.load(); err != nil {
+		log.Printf("podcast: loading state failed: %v", err)
+	}
+	go p.run()
+	return p
+}
+
+func (p *Station) Name() string {
+	return "Podcasts"
+}
+
+func (p *Station) Logo() image.Image {
+	return p.logo
+}
+
+// Stream plays the newest unplayed episode that has been downloaded, from
+// where it was left off.
+func (p *Station) Stream() player.Stream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cur = ""
+	guid, ep := p.nextLocked()
+	if ep == nil {
+		return player.Stream{}
+	}
+	p.cur = guid
+	return player.Stream{URL: filepath.Join(p.dir, ep.File), Start: ep.Position}
+}
+
+// nextLocked returns the newest unplayed episode that has been downloaded,
+// other than the one playing, and its GUID. It returns nil if there is none.
+func (p *Station) nextLocked() (string, *episodeState) {
+	var (
+		next     *episodeState
+		nextGUID string
+	)
+	for guid, ep := range p.eps {
+		if ep.Played || ep.File == "" || guid == p.cur {
+			continue
+		}
+		if next == nil || ep.Published.After(next.Published) {
+			next, nextGUID = ep, guid
+		}
+	}
+	return nextGUID, next
+}
+
+func (p *Station) Local() bool {
+	return true
+}
+
+func (p *Station) SetPosition(pos, length time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep, ok := p.eps[p.cur]
+	if !ok {
+		return
+	}
+	ep.Position = pos
+	if length > 0 && length-pos < playedMargin {
+		ep.Played = true
+	}
+	if err := p.saveLocked(); err != nil {
+		log.Printf("podcast: saving state failed: %v", err)
+	}
+}
+
+func (p *Station) Status() station.Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep, ok := p.eps[p.cur]
+	if !ok {
+		return station.Status{Show: "No episodes downloaded"}
+	}
+	st := station.Status{Show: ep.Show, Track: ep.Title}
+	if _, next := p.nextLocked(); next != nil {
+		st.Next = next.Title
+	}
+	return st
+}
+
+// run checks the feeds for new episodes every refresh.
+func (p *Station) run() {
+	for {
+		for _, feed := range p.feeds {
+			if err := p.update(feed); err != nil {
+				log.Printf("podcast: updating %s failed: %v", feed, err)
+			}
+		}
+		time.Sleep(p.refresh)
+	}
+}
+
+// update fetches a feed, downloads its newest episodes and deletes the ones
+// that are no longer kept.
+func (p *Station) update(feedURL string) error {
+	resp, err := http.Get(feedURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", feedURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	feed, err := ParseFeed(data)
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	var fetch []Episode
+	p.mu.Lock()
+	for i, e := range feed.Episodes {
+		// Enclosure links may be relative to the feed.
+		if u, err := base.Parse(e.URL); err == nil {
+			e.URL = u.String()
+		}
+		ep, ok := p.eps[e.GUID]
+		if !ok {
+			ep = &episodeState{Feed: feedURL}
+			p.eps[e.GUID] = ep
+		}
+		ep.Show, ep.Title, ep.URL, ep.Published = feed.Title, e.Title, e.URL, e.Published
+		if i < p.keep {
+			keep[e.GUID] = true
+			if ep.File == "" {
+				fetch = append(fetch, e)
+			}
+		}
+	}
+	p.pruneLocked(feedURL, keep)
+	err = p.saveLocked()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range fetch {
+		file, err := p.download(e)
+		if err != nil {
+			log.Printf("podcast: downloading %q failed: %v", e.Title, err)
+			continue
+		}
+		p.mu.Lock()
+		if ep, ok := p.eps[e.GUID]; ok {
+			ep.File = file
+		}
+		err = p.saveLocked()
+		p.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneLocked deletes the downloads of the feed's episodes that are not in
+// keep, and forgets those that were never started. The episode playing is
+// left alone.
+func (p *Station) pruneLocked(feedURL string, keep map[string]bool) {
+	for guid, ep := range p.eps {
+		if ep.Feed != feedURL || keep[guid] || guid == p.cur {
+			continue
+		}
+		if ep.File != "" {
+			if err := os.Remove(filepath.Join(p.dir, ep.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("podcast: %v", err)
+			}
+			ep.File = ""
+		}
+		if !ep.Played && ep.Position == 0 {
+			// Nothing worth remembering.
+			delete(p.eps, guid)
+		}
+	}
+}
+
+// download fetches an episode into the podcast directory, and returns the
+// name of its file.
+func (p *Station) download(e Episode) (string, error) {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(e.GUID))
+	name := hex.EncodeToString(sum[:8])
+	if u, err := url.Parse(e.URL); err == nil && path.Ext(u.Path) != "" {
+		name += path.Ext(u.Path)
+	} else {
+		name += ".mp3"
+	}
+
+	resp, err := http.Get(e.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s failed: %s", e.URL, resp.Status)
+	}
+	// Download to a temporary file, so that a half downloaded episode is
+	// never played.
+	tmp := filepath.Join(p.dir, name+".part")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(p.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	log.Printf("podcast: downloaded %q", e.Title)
+	return name, nil
+}
+
+func (p *Station) statePath() string {
+	return filepath.Join(p.dir, "state.json")
+}
+
+func (p *Station) load() error {
+	data, err := os.ReadFile(p.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &p.eps)
+}
+
+func (p *Station) saveLocked() error {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p.eps, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.statePath(), data, 0644)
+}
@@ -0,0 +1,148 @@
+package podcast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const newEpisode = `<item>
+			<title>Episode 4</title>
+			<guid>show-4</guid>
+			<pubDate>Tue, 19 Mar 2024 10:00:00 +0000</pubDate>
+			<enclosure url="/audio/ep4.mp3" length="6" type="audio/mpeg"/>
+		</item>
+		`
+
+// feedServer serves testdata/feed.rss and its episodes, whose contents are
+// their names.
+type feedServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	feed string
+}
+
+func newFeedServer(t *testing.T) *feedServer {
+	data, err := os.ReadFile(filepath.Join("testdata", "feed.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &feedServer{feed: string(data)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.rss", func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		w.Write([]byte(fs.feed))
+	})
+	mux.HandleFunc("/audio/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/audio/")))
+	})
+	fs.Server = httptest.NewServer(mux)
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// newStation returns a station keeping two episodes in dir, without
+// starting its background updates.
+func newStation(feed, dir string) *Station {
+	p := &Station{
+		feeds: []string{feed},
+		dir:   dir,
+		keep:  2,
+		eps:   make(map[string]*episodeState),
+	}
+	if err := p.load(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// playing returns the contents of the file that p's stream plays, and where
+// it starts.
+func playing(t *testing.T, p *Station) (string, time.Duration) {
+	t.Helper()
+	s := p.Stream()
+	if s.URL == "" {
+		return "", 0
+	}
+	data, err := os.ReadFile(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), s.Start
+}
+
+func TestStation(t *testing.T) {
+	srv := newFeedServer(t)
+	feed := srv.URL + "/feed.rss"
+	dir := t.TempDir()
+
+	p := newStation(feed, dir)
+	if got, _ := playing(t, p); got != "" {
+		t.Errorf("playing %q before any downloads", got)
+	}
+	if err := p.update(feed); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	// Only the newest two episodes are kept, and the one never downloaded
+	// is forgotten.
+	if len(p.eps) != 2 || p.eps["show-3"] == nil || p.eps["show-2"] == nil {
+		t.Errorf("episodes = %v, want show-3 and show-2", p.eps)
+	}
+
+	if got, start := playing(t, p); got != "ep3.mp3" || start != 0 {
+		t.Errorf("playing %q from %v, want ep3.mp3 from the start", got, start)
+	}
+	st := p.Status()
+	if st.Show != "Radio Show" || st.Track != "Episode 3" || st.Next != "Episode 2" {
+		t.Errorf("Status = %+v", st)
+	}
+
+	// The position is remembered across restarts.
+	p.SetPosition(30*time.Second, 10*time.Minute)
+	p = newStation(feed, dir)
+	if got, start := playing(t, p); got != "ep3.mp3" || start != 30*time.Second {
+		t.Errorf("after restart, playing %q from %v, want ep3.mp3 from 30s", got, start)
+	}
+
+	// Getting near the end marks the episode played, and moves on.
+	p.SetPosition(9*time.Minute+30*time.Second, 10*time.Minute)
+	if got, _ := playing(t, p); got != "ep2.mp3" {
+		t.Errorf("after finishing, playing %q, want ep2.mp3", got)
+	}
+
+	// A new episode is downloaded, pushing out the oldest. The one playing
+	// is left alone until it is not.
+	srv.mu.Lock()
+	srv.feed = strings.Replace(srv.feed, "<item>", newEpisode+"<item>", 1)
+	srv.mu.Unlock()
+	if err := p.update(feed); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if ep := p.eps["show-2"]; ep == nil || ep.File == "" {
+		t.Errorf("episode playing was pruned")
+	}
+	if got, _ := playing(t, p); got != "ep4.mp3" {
+		t.Errorf("playing %q, want the new ep4.mp3", got)
+	}
+	file := p.eps["show-2"].File
+	if err := p.update(feed); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, ok := p.eps["show-2"]; ok {
+		t.Errorf("unstarted episode show-2 was remembered after pruning")
+	}
+	if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+		t.Errorf("pruned episode's file is still there: %v", err)
+	}
+	// The played episode is remembered, so it is not played again.
+	if ep := p.eps["show-3"]; ep == nil || !ep.Played {
+		t.Errorf("played episode show-3 = %+v", ep)
+	}
+}
@@ -0,0 +1,147 @@
+// Package radiobrowser is a client for the radio-browser.info station
+// directory.
+package radiobrowser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultBaseURL round-robins between the radio-browser.info servers.
+const DefaultBaseURL = "https://all.api.radio-browser.info"
+
+// userAgent identifies us to the API, which asks clients to say who they are.
+const userAgent = "boss-radio/1.0"
+
+// Station is a station in the directory.
+type Station struct {
+	UUID string `json:"stationuuid"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// ResolvedURL is URL with any playlist resolved to the stream in it.
+	ResolvedURL string `json:"url_resolved"`
+	Homepage    string `json:"homepage"`
+	Favicon     string `json:"favicon"`
+	// Tags is a comma separated list of tags, like "jazz,public radio".
+	Tags        string `json:"tags"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countrycode"`
+	Codec       string `json:"codec"`
+	// Bitrate is in kbps.
+	Bitrate    int `json:"bitrate"`
+	ClickCount int `json:"clickcount"`
+}
+
+// StreamURL returns the URL to play the station from.
+func (s Station) StreamURL() string {
+	if s.ResolvedURL != "" {
+		return s.ResolvedURL
+	}
+	return s.URL
+}
+
+// Query is a directory search. Empty fields match everything.
+type Query struct {
+	Name    string
+	Tag     string
+	Country string
+	// Limit is the most results to return. It defaults to 50.
+	Limit int
+}
+
+// Client talks to a radio-browser.info server.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// New returns a client for the server at baseURL, or DefaultBaseURL if it is
+// empty.
+func New(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+// Search returns the working stations matching q, most clicked first.
+func (c *Client) Search(q Query) ([]Station, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	v := url.Values{
+		"hidebroken": {"true"},
+		"order":      {"clickcount"},
+		"reverse":    {"true"},
+		"limit":      {strconv.Itoa(limit)},
+	}
+	if q.Name != "" {
+		v.Set("name", q.Name)
+	}
+	if q.Tag != "" {
+		v.Set("tag", q.Tag)
+	}
+	if q.Country != "" {
+		v.Set("country", q.Country)
+	}
+	var stns []Station
+	if err := c.get("/json/stations/search?"+v.Encode(), &stns); err != nil {
+		return nil, err
+	}
+	return stns, nil
+}
+
+// Station looks up a station by its UUID.
+func (c *Client) Station(uuid string) (Station, error) {
+	var stns []Station
+	if err := c.get("/json/stations/byuuid/"+url.PathEscape(uuid), &stns); err != nil {
+		return Station{}, err
+	}
+	if len(stns) == 0 {
+		return Station{}, fmt.Errorf("no station %s", uuid)
+	}
+	return stns[0], nil
+}
+
+// Click counts a play of the station, which the directory uses to rank
+// stations. It returns the station's stream URL.
+func (c *Client) Click(uuid string) (string, error) {
+	var res struct {
+		OK      bool   `json:"ok"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+	}
+	if err := c.get("/json/url/"+url.PathEscape(uuid), &res); err != nil {
+		return "", err
+	}
+	if !res.OK {
+		return "", fmt.Errorf("click failed: %s", res.Message)
+	}
+	return res.URL, nil
+}
+
+// get fetches path and decodes its JSON into v.
+func (c *Client) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
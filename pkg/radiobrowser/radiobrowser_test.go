@@ -0,0 +1,150 @@
+package radiobrowser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureServer serves testdata/search.json as a radio-browser server,
+// recording the last search's query.
+func fixtureServer(t *testing.T, query *url.Values) *httptest.Server {
+	search, err := os.ReadFile(filepath.Join("testdata", "search.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/stations/search", func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != userAgent {
+			t.Errorf("User-Agent = %q, want %q", ua, userAgent)
+		}
+		*query = r.URL.Query()
+		w.Write(search)
+	})
+	mux.HandleFunc("/json/stations/byuuid/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json/stations/byuuid/9617a958-0601-11e8-ae97-52543be04c81":
+			w.Write([]byte(`[{"stationuuid": "9617a958-0601-11e8-ae97-52543be04c81", "name": "WFMU", "url_resolved": "http://stream0.wfmu.org/freeform-128k"}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	})
+	mux.HandleFunc("/json/url/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json/url/9617a958-0601-11e8-ae97-52543be04c81":
+			w.Write([]byte(`{"ok": true, "message": "retrieved station url", "stationuuid": "9617a958-0601-11e8-ae97-52543be04c81", "name": "WFMU", "url": "http://stream0.wfmu.org/freeform-128k"}`))
+		default:
+			w.Write([]byte(`{"ok": false, "message": "did not find station with matching id"}`))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearch(t *testing.T) {
+	var q url.Values
+	c := New(fixtureServer(t, &q).URL + "/")
+
+	stns, err := c.Search(Query{Name: "wfmu", Country: "US"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for k, want := range map[string]string{
+		"name":       "wfmu",
+		"country":    "US",
+		"tag":        "",
+		"limit":      "50",
+		"order":      "clickcount",
+		"reverse":    "true",
+		"hidebroken": "true",
+	} {
+		if got := q.Get(k); got != want {
+			t.Errorf("query %s = %q, want %q", k, got, want)
+		}
+	}
+
+	if len(stns) != 2 {
+		t.Fatalf("Search returned %d stations, want 2", len(stns))
+	}
+	want := Station{
+		UUID:        "9617a958-0601-11e8-ae97-52543be04c81",
+		Name:        "WFMU",
+		URL:         "http://stream0.wfmu.org/freeform-128k.m3u",
+		ResolvedURL: "http://stream0.wfmu.org/freeform-128k",
+		Homepage:    "https://wfmu.org/",
+		Favicon:     "https://wfmu.org/favicon.ico",
+		Tags:        "freeform,independent",
+		Country:     "The United States Of America",
+		CountryCode: "US",
+		Codec:       "MP3",
+		Bitrate:     128,
+		ClickCount:  412,
+	}
+	if stns[0] != want {
+		t.Errorf("Search()[0] = %+v, want %+v", stns[0], want)
+	}
+	if got := stns[0].StreamURL(); got != want.ResolvedURL {
+		t.Errorf("StreamURL = %q, want the resolved URL", got)
+	}
+	if got := stns[1].StreamURL(); got != "http://example.com/live" {
+		t.Errorf("StreamURL without a resolved URL = %q, want the URL", got)
+	}
+
+	if _, err := c.Search(Query{Tag: "jazz", Limit: 5}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if q.Get("tag") != "jazz" || q.Get("limit") != "5" || q.Get("name") != "" {
+		t.Errorf("query = %v, want tag jazz and limit 5", q)
+	}
+}
+
+func TestStationAndClick(t *testing.T) {
+	var q url.Values
+	c := New(fixtureServer(t, &q).URL)
+
+	stn, err := c.Station("9617a958-0601-11e8-ae97-52543be04c81")
+	if err != nil {
+		t.Fatalf("Station failed: %v", err)
+	}
+	if stn.Name != "WFMU" || stn.StreamURL() != "http://stream0.wfmu.org/freeform-128k" {
+		t.Errorf("Station = %+v", stn)
+	}
+	if _, err := c.Station("missing"); err == nil {
+		t.Errorf("Station of an unknown UUID succeeded")
+	}
+
+	u, err := c.Click("9617a958-0601-11e8-ae97-52543be04c81")
+	if err != nil {
+		t.Fatalf("Click failed: %v", err)
+	}
+	if u != "http://stream0.wfmu.org/freeform-128k" {
+		t.Errorf("Click = %q", u)
+	}
+	if _, err := c.Click("missing"); err == nil {
+		t.Errorf("Click of an unknown UUID succeeded")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+	if _, err := c.Search(Query{Name: "x"}); err == nil {
+		t.Errorf("Search succeeded against a failing server")
+	}
+	if _, err := c.Click("x"); err == nil {
+		t.Errorf("Click succeeded against a failing server")
+	}
+}
+
+func TestNewDefault(t *testing.T) {
+	if c := New(""); c.BaseURL != DefaultBaseURL {
+		t.Errorf("BaseURL = %q, want %q", c.BaseURL, DefaultBaseURL)
+	}
+}
@@ -0,0 +1,33 @@
+package recorder
+
+import "sort"
+
+// id3Tag returns an ID3v2.4 tag holding the given text frames, like TIT2.
+// Empty frames are left out.
+func id3Tag(frames map[string]string) []byte {
+	ids := make([]string, 0, len(frames))
+	for id, text := range frames {
+		if text != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var body []byte
+	for _, id := range ids {
+		// Encoding 3 is UTF-8.
+		data := append([]byte{3}, frames[id]...)
+		body = append(body, id...)
+		body = append(body, syncsafe(len(data))...)
+		body = append(body, 0, 0)
+		body = append(body, data...)
+	}
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = append(tag, syncsafe(len(body))...)
+	return append(tag, body...)
+}
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
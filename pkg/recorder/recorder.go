@@ -0,0 +1,356 @@
+// Package recorder records stations to disk, one file per show.
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// statusInterval is how often the station's status is checked for a new
+// show or track.
+const statusInterval = 30 * time.Second
+
+// Recording describes a recorded file. It is kept in a JSON file next to the
+// recording.
+type Recording struct {
+	// File is the name of the recording in the recordings directory.
+	File    string    `json:"file"`
+	Station string    `json:"station"`
+	Show    string    `json:"show"`
+	Start   time.Time `json:"start"`
+	// End is zero while still recording.
+	End time.Time `json:"end"`
+	// Tracks are the tracks played during the recording, as "Artist - Track".
+	Tracks []string `json:"tracks,omitempty"`
+	Size   int64    `json:"size"`
+}
+
+// List returns the recordings in dir, newest first.
+func List(dir string) ([]Recording, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var recs []Recording
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Start.After(recs[j].Start) })
+	return recs, nil
+}
+
+// Recorder records a station, starting a new file whenever the show changes.
+// It has its own connection to the stream, so it carries on whatever the
+// radio is playing.
+type Recorder struct {
+	stn    station.Station
+	dir    string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	ext  string
+	f    *os.File
+	rec  Recording
+	last string
+}
+
+// Start starts recording stn into dir. The recording stops after d, or when
+// Stop is called if d is 0.
+func Start(stn station.Station, dir string, d time.Duration) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if d > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), d)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	r := &Recorder{stn: stn, dir: dir, cancel: cancel, done: make(chan struct{})}
+
+	body, ext, err := open(ctx, stn)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.ext = ext
+	if err := r.split(stn.Status()); err != nil {
+		body.Close()
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		body.Close()
+	}()
+	go r.watch(ctx)
+	go func() {
+		defer close(r.done)
+		_, err := io.Copy(r, body)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("recorder: %s: %v", stn.Name(), err)
+		}
+		cancel()
+		r.finish()
+	}()
+	return r, nil
+}
+
+// open opens the station's stream, and returns it along with the file
+// extension for its format.
+func open(ctx context.Context, stn station.Station) (io.ReadCloser, string, error) {
+	s := stn.Stream()
+	if len(s.Cmd) > 0 {
+		return nil, "", fmt.Errorf("can not record %s", stn.Name())
+	}
+	if s.Open != nil {
+		// HLS audio segments are usually AAC.
+		rc, err := s.Open()
+		return rc, ".aac", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("GET %s failed: %s", s.URL, resp.Status)
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return resp.Body, extension(ct), nil
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "audio/aac", "audio/aacp", "audio/x-aac":
+		return ".aac"
+	case "audio/ogg", "application/ogg":
+		return ".ogg"
+	case "audio/flac":
+		return ".flac"
+	default:
+		return ".mp3"
+	}
+}
+
+// Write writes stream data to the current file.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		// Starting the file failed, so drop the data until the next show.
+		return len(p), nil
+	}
+	n, err := r.f.Write(p)
+	r.rec.Size += int64(n)
+	return n, err
+}
+
+// watch checks the station's status, splitting the recording when the show
+// changes and noting the tracks played.
+func (r *Recorder) watch(ctx context.Context) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		r.update(r.stn.Status())
+	}
+}
+
+// update splits the recording if st is a new show, or notes its track
+// otherwise. Statuses that failed to be fetched are ignored, so that a
+// passing metadata outage does not split the show.
+func (r *Recorder) update(st station.Status) {
+	if st.Failed {
+		return
+	}
+	r.mu.Lock()
+	show := r.rec.Show
+	r.mu.Unlock()
+	if st.Show != "" && st.Show != show {
+		if err := r.split(st); err != nil {
+			log.Printf("recorder: splitting %s failed: %v", r.stn.Name(), err)
+		}
+		return
+	}
+	r.noteTrack(st)
+}
+
+// split closes the current file, if any, and starts a new one for st.
+func (r *Recorder) split(st station.Status) error {
+	if st.Failed {
+		// The error is not the show's name.
+		st = station.Status{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.f != nil {
+		r.closeLocked(now)
+	}
+
+	name := now.Format("2006-01-02-150405") + " " + r.stn.Name()
+	if st.Show != "" {
+		name += " - " + st.Show
+	}
+	f, name, err := r.create(sanitize(name))
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.last = ""
+	r.rec = Recording{
+		File:    name + r.ext,
+		Station: r.stn.Name(),
+		Show:    st.Show,
+		Start:   now,
+	}
+	if r.ext == ".mp3" || r.ext == ".aac" {
+		tag := id3Tag(map[string]string{
+			"TIT2": st.Show,
+			"TPE1": r.stn.Name(),
+			"TALB": r.stn.Name(),
+			"TDRC": now.Format("2006-01-02T15:04"),
+		})
+		n, err := f.Write(tag)
+		r.rec.Size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	r.noteTrackLocked(st)
+	return r.saveLocked()
+}
+
+// create creates a new recording called name, adding a number to the name if
+// there is already one, and returns it and the name used.
+func (r *Recorder) create(name string) (*os.File, string, error) {
+	for i := 1; ; i++ {
+		n := name
+		if i > 1 {
+			n = fmt.Sprintf("%s (%d)", name, i)
+		}
+		f, err := os.OpenFile(filepath.Join(r.dir, n+r.ext), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, n, err
+	}
+}
+
+func (r *Recorder) noteTrack(st station.Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.noteTrackLocked(st) {
+		if err := r.saveLocked(); err != nil {
+			log.Printf("recorder: saving %s failed: %v", r.rec.File, err)
+		}
+	}
+}
+
+// noteTrackLocked adds the track in st to the recording, if it is new.
+func (r *Recorder) noteTrackLocked(st station.Status) bool {
+	track := st.Track
+	if st.Artist != "" {
+		track = st.Artist + " - " + st.Track
+	}
+	if st.Track == "" || track == r.last {
+		return false
+	}
+	r.last = track
+	r.rec.Tracks = append(r.rec.Tracks, track)
+	return true
+}
+
+func (r *Recorder) closeLocked(end time.Time) {
+	r.f.Close()
+	r.f = nil
+	r.rec.End = end
+	if err := r.saveLocked(); err != nil {
+		log.Printf("recorder: saving %s failed: %v", r.rec.File, err)
+	}
+}
+
+// saveLocked writes the recording's JSON file.
+func (r *Recorder) saveLocked() error {
+	data, err := json.MarshalIndent(r.rec, "", "\t")
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(r.rec.File, filepath.Ext(r.rec.File))
+	return os.WriteFile(filepath.Join(r.dir, base+".json"), data, 0644)
+}
+
+func (r *Recorder) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.closeLocked(time.Now())
+	}
+}
+
+// Station returns the station being recorded.
+func (r *Recorder) Station() station.Station {
+	return r.stn
+}
+
+// Done is closed once the recording has stopped.
+func (r *Recorder) Done() <-chan struct{} {
+	return r.done
+}
+
+// Stop stops recording and waits for the file to be closed.
+func (r *Recorder) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// sanitize makes name safe to use as a file name.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,100 @@
+package recorder
+
+import (
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+// fakeStation streams from a URL, with whatever status it is given.
+type fakeStation struct {
+	url string
+
+	mu sync.Mutex
+	st station.Status
+}
+
+func (s *fakeStation) Name() string          { return "Fake" }
+func (s *fakeStation) Logo() image.Image     { return nil }
+func (s *fakeStation) Stream() player.Stream { return player.Stream{URL: s.url} }
+
+func (s *fakeStation) Status() station.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.st
+}
+
+// streamServer serves an endless MP3 stream, until the test ends.
+func streamServer(t *testing.T) *httptest.Server {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte{0xff, 0xfb, 0x90, 0x00})
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestSplits(t *testing.T) {
+	dir := t.TempDir()
+	stn := &fakeStation{url: streamServer(t).URL, st: station.Status{Show: "Morning"}}
+	r, err := Start(stn, dir, 0)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// A failed status fetch neither splits the show nor names a file.
+	r.update(station.ErrStatus(errors.New("metadata fetch failed")))
+	r.update(station.Status{Show: "Morning", Artist: "A", Track: "One"})
+	// Two new shows within the same second get files of their own.
+	r.update(station.Status{Show: "Noon"})
+	r.update(station.Status{Show: "Morning"})
+	r.Stop()
+
+	recs, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d recordings, want 3: %+v", len(recs), recs)
+	}
+	files := make(map[string]bool)
+	shows := make(map[string]int)
+	tracks := 0
+	for _, rec := range recs {
+		files[rec.File] = true
+		shows[rec.Show]++
+		if rec.End.IsZero() {
+			t.Errorf("%s has no end", rec.File)
+		}
+		if len(rec.Tracks) > 0 {
+			tracks++
+			if rec.Show != "Morning" || len(rec.Tracks) != 1 || rec.Tracks[0] != "A - One" {
+				t.Errorf("%s tracks = %v", rec.File, rec.Tracks)
+			}
+		}
+	}
+	if tracks != 1 {
+		t.Errorf("%d recordings have tracks, want 1", tracks)
+	}
+	if len(files) != 3 {
+		t.Errorf("recordings share files: %+v", recs)
+	}
+	if shows["Morning"] != 2 || shows["Noon"] != 1 {
+		t.Errorf("shows = %v, want Morning twice and Noon once", shows)
+	}
+}
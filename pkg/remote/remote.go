@@ -1,7 +1,11 @@
 package remote
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"periph.io/x/conn/v3/ir"
 	"periph.io/x/devices/v3/lirc"
@@ -9,41 +13,97 @@ import (
 	"github.com/nlacasse/boss-radio/pkg/events"
 )
 
-// Codes for Apple A1156.
-var btnMap = map[ir.Key]events.Event{
-	ir.KEY_KPPLUS:      events.RemoteUp,
-	ir.KEY_KPMINUS:     events.RemoteDown,
-	ir.KEY_REWIND:      events.RemoteLeft,
-	ir.KEY_FASTFORWARD: events.RemoteRight,
-	ir.KEY_PLAY:        events.RemotePlay,
-	ir.KEY_MENU:        events.RemoteMenu,
-}
+type Remote struct {
+	// btnMap maps lircd keys to the keys they act as.
+	btnMap map[ir.Key]events.Key
 
-type Remote struct{}
+	mu   sync.Mutex
+	conn *lirc.Conn
+}
 
-func New() *Remote {
-	return &Remote{}
+func New(btnMap map[ir.Key]events.Key) *Remote {
+	return &Remote{btnMap: btnMap}
 }
 
-func (r *Remote) Listen(ch chan<- events.Event) error {
+// Start listens to lircd and sends key presses on ch, until ctx is done or
+// Stop is called.
+func (r *Remote) Start(ctx context.Context, ch chan<- events.Event) error {
 	// Open a handle to lircd:
 	conn, err := lirc.New()
 	if err != nil {
 		return err
 	}
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
 
 	go func() {
-		for msg := range conn.Channel() {
-			if msg.Repeat {
-				continue
+		defer r.Stop()
+		var count int
+		for {
+			var msg ir.Message
+			var ok bool
+			select {
+			case msg, ok = <-conn.Channel():
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
 			}
-			ev, ok := btnMap[msg.Key]
+			key, ok := r.btnMap[msg.Key]
 			if !ok {
 				log.Printf("unknown key: %v", msg.Key)
 				continue
 			}
-			ch <- ev
+			ev := events.Event{Key: key, Gesture: events.Press}
+			if msg.Repeat {
+				count++
+				ev = events.Event{Key: key, Gesture: events.Repeat, Count: count}
+			} else {
+				count = 0
+			}
+			if !events.Send(ctx, ch, ev) {
+				return
+			}
 		}
 	}()
 	return nil
 }
+
+// Stop closes the connection to lircd.
+func (r *Remote) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// WaitForKey returns the next key pressed on any remote, or an error if none
+// is within timeout. It is used to learn the keys of a new remote.
+func WaitForKey(timeout time.Duration) (ir.Key, error) {
+	conn, err := lirc.New()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg, ok := <-conn.Channel():
+			if !ok {
+				return "", fmt.Errorf("lircd connection closed")
+			}
+			if !msg.Repeat {
+				return msg.Key, nil
+			}
+		case <-deadline:
+			return "", fmt.Errorf("no key pressed within %v", timeout)
+		}
+	}
+}
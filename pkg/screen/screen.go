@@ -21,8 +21,9 @@ type Screen struct {
 	dev  *sh1106.Dev
 	face font.Face
 
-	mu     sync.RWMutex
-	buffer [6]string
+	mu       sync.RWMutex
+	buffer   [6]string
+	progress float64
 }
 
 func New() (*Screen, error) {
@@ -42,6 +43,7 @@ func New() (*Screen, error) {
 		dev:  dev,
 		face: basicfont.Face7x13,
 		//face: inconsolata.Regular8x16,
+		progress: -1,
 	}
 	scrn.clearLocked()
 	return scrn, nil
@@ -58,8 +60,12 @@ func (s *Screen) SetText(text [6]string) {
 	s.buffer = text
 }
 
+// ClearText clears all text lines and hides the progress bar.
 func (s *Screen) ClearText() {
-	s.SetText([6]string{})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = [6]string{}
+	s.progress = -1
 }
 
 func (s *Screen) SetTextLine(i int, text string) {
@@ -72,6 +78,14 @@ func (s *Screen) SetTextLine(i int, text string) {
 	s.buffer[i] = text
 }
 
+// SetProgress shows a progress bar filled to p (between 0 and 1) in place of
+// the second text line. A negative p hides the bar.
+func (s *Screen) SetProgress(p float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = p
+}
+
 func (s *Screen) PushText(text string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -146,9 +160,57 @@ func (s *Screen) Draw() {
 		}
 		dr.DrawString(l)
 	}
+	if s.progress >= 0 {
+		drawProgress(img, s.progress)
+	}
 	s.dev.Draw(img.Bounds(), img, image.Point{X: 0, Y: 0})
 }
 
+// drawProgress draws an outlined bar filled to p across the second text line.
+func drawProgress(img *image.Gray, p float64) {
+	const top, bottom = 13, 19
+	on := image.NewUniform(image1bit.On)
+	outline := image.Rect(0, top, 128, bottom)
+	draw.Draw(img, outline, on, image.Point{}, draw.Src)
+	draw.Draw(img, outline.Inset(1), image.Black, image.Point{}, draw.Src)
+	fill := outline.Inset(2)
+	fill.Max.X = fill.Min.X + int(p*float64(fill.Dx()))
+	draw.Draw(img, fill, on, image.Point{}, draw.Src)
+}
+
 func (s *Screen) Invert(b bool) {
 	s.dev.Invert(b)
 }
+
+var heartRows = []string{
+	"..XXXX......XXXX..",
+	".XXXXXX....XXXXXX.",
+	"XXXXXXXX..XXXXXXXX",
+	"XXXXXXXXXXXXXXXXXX",
+	"XXXXXXXXXXXXXXXXXX",
+	"XXXXXXXXXXXXXXXXXX",
+	".XXXXXXXXXXXXXXXX.",
+	"..XXXXXXXXXXXXXX..",
+	"...XXXXXXXXXXXX...",
+	"....XXXXXXXXXX....",
+	".....XXXXXXXX.....",
+	"......XXXXXX......",
+	".......XXXX.......",
+	"........XX........",
+}
+
+// Heart returns a heart icon, scaled up to fill most of the screen height.
+func Heart() image.Image {
+	const scale = 4
+	img := image.NewGray(image.Rect(0, 0, len(heartRows[0])*scale, len(heartRows)*scale))
+	on := image.NewUniform(image1bit.On)
+	for y, row := range heartRows {
+		for x, c := range row {
+			if c == 'X' {
+				r := image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale)
+				draw.Draw(img, r, on, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
@@ -3,23 +3,25 @@ package station
 import (
 	"bytes"
 	_ "embed"
-	"encoding/json"
 	"image"
 	_ "image/gif"
-	"io"
 	"log"
-	"net/http"
-	"os/exec"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/aporee.gif
 var aporeeLogoBytes []byte
 
-type aporeeStatus struct {
-	Date  string `json:"aporee_date"`
-	Lat   string `json:"aporee_lat"`
-	Lng   string `json:"aporee_lng"`
-	Title string `json:"aporee_title"`
+// aporeeMetadataURL is where the station's Status comes from.
+const aporeeMetadataURL = "https://radio.aporee.org/spool/meta.js"
+
+// aporeeMetadata shows the recording's title, and where it was made.
+var aporeeMetadata = Metadata{
+	URL:   aporeeMetadataURL,
+	Show:  "aporee_title",
+	Track: "aporee_lat",
+	Album: "aporee_lng",
 }
 
 type Aporee struct {
@@ -27,11 +29,12 @@ type Aporee struct {
 }
 
 var _ Station = (*Aporee)(nil)
+var _ Metadater = (*Aporee)(nil)
 
 func NewAporee() *Aporee {
 	logo, _, err := image.Decode(bytes.NewReader(aporeeLogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode Aporee logo: %w", err)
+		log.Fatalf("Could not decode Aporee logo: %v", err)
 	}
 
 	return &Aporee{
@@ -47,35 +50,14 @@ func (aporee *Aporee) Logo() image.Image {
 	return aporee.logo
 }
 
-func (aporee *Aporee) StreamCmd() *exec.Cmd {
-	str := "http://radio.aporee.org:8000/aporee_high"
-	return exec.Command("mpv", "-no-video", str)
+func (aporee *Aporee) Stream() player.Stream {
+	return player.Stream{URL: "http://radio.aporee.org:8000/aporee_high"}
 }
 
-func (aporee *Aporee) Status() Status {
-	var s Status
-
-	resp, err := http.Get("https://radio.aporee.org/spool/meta.js")
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-
-	var as aporeeStatus
-	if err := json.Unmarshal(body, &as); err != nil {
-		s.Show = err.Error()
-		return s
-	}
+func (aporee *Aporee) MetadataURL() string {
+	return aporeeMetadataURL
+}
 
-	return Status{
-		Show:  as.Title,
-		Track: as.Lat,
-		Album: as.Lng,
-	}
+func (aporee *Aporee) Status() Status {
+	return aporeeMetadata.Status()
 }
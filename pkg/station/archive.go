@@ -0,0 +1,54 @@
+package station
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+// archiveCacheTime is how long a list of archived episodes is reused, so that
+// an episode picked from a list is still in the list when it is played.
+const archiveCacheTime = 10 * time.Minute
+
+// Archiver is implemented by stations that publish recordings of past shows.
+type Archiver interface {
+	// Episodes returns the recently archived episodes, newest first.
+	Episodes() ([]Episode, error)
+
+	// EpisodeStream returns the stream of an archived episode.
+	EpisodeStream(ep Episode) (player.Stream, error)
+}
+
+// Episode is an archived episode of a show.
+type Episode struct {
+	// ID identifies the episode to its station.
+	ID    string
+	Show  string
+	Title string
+	// Aired is when the episode was broadcast.
+	Aired time.Time
+}
+
+// episodeCache holds a station's list of archived episodes.
+type episodeCache struct {
+	mu      sync.Mutex
+	eps     []Episode
+	fetched time.Time
+}
+
+// get returns the cached episodes, calling fetch for new ones if they are
+// too old.
+func (c *episodeCache) get(fetch func() ([]Episode, error)) ([]Episode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eps != nil && time.Since(c.fetched) < archiveCacheTime {
+		return c.eps, nil
+	}
+	eps, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.eps, c.fetched = eps, time.Now()
+	return eps, nil
+}
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/bluetooth.gif
@@ -22,7 +24,7 @@ var _ Station = (*Bluetooth)(nil)
 func NewBluetooth() *Bluetooth {
 	logo, _, err := image.Decode(bytes.NewReader(bluetoothLogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode Bluetooth logo: %w", err)
+		log.Fatalf("Could not decode Bluetooth logo: %v", err)
 	}
 
 	return &Bluetooth{
@@ -38,8 +40,8 @@ func (bt *Bluetooth) Logo() image.Image {
 	return bt.logo
 }
 
-func (bt *Bluetooth) StreamCmd() *exec.Cmd {
-	return exec.Command("bluealsa-aplay")
+func (bt *Bluetooth) Stream() player.Stream {
+	return player.Stream{Cmd: []string{"bluealsa-aplay"}, DeviceFlag: "--pcm"}
 }
 
 func (bt *Bluetooth) Status() Status {
@@ -0,0 +1,75 @@
+package station
+
+import (
+	"bytes"
+	_ "embed"
+	"image"
+	_ "image/gif"
+	"log"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+//go:embed images/radio.gif
+var radioLogoBytes []byte
+
+// Generic is a station that only has a stream URL, like those added from the
+// station directory, and perhaps a simple metadata endpoint.
+type Generic struct {
+	name      string
+	url       string
+	meta      *Metadata
+	fallbacks []player.Source
+	logo      image.Image
+}
+
+var _ Station = (*Generic)(nil)
+var _ Metadater = (*Generic)(nil)
+
+// NewGeneric returns a station playing url, or fallbacks in order if it
+// fails. Its Status comes from meta, if it is not nil.
+func NewGeneric(name, url string, meta *Metadata, fallbacks ...player.Source) *Generic {
+	logo, _, err := image.Decode(bytes.NewReader(radioLogoBytes))
+	if err != nil {
+		log.Fatalf("Could not decode radio logo: %v", err)
+	}
+
+	return &Generic{
+		name:      name,
+		url:       url,
+		meta:      meta,
+		fallbacks: fallbacks,
+		logo:      logo,
+	}
+}
+
+func (g *Generic) Name() string {
+	return g.name
+}
+
+func (g *Generic) Logo() image.Image {
+	return g.logo
+}
+
+func (g *Generic) Stream() player.Stream {
+	if len(g.fallbacks) == 0 {
+		return player.Stream{URL: g.url}
+	}
+	return player.FromSources(append([]player.Source{{URL: g.url}}, g.fallbacks...)...)
+}
+
+// MetadataURL returns "" for stations without metadata.
+func (g *Generic) MetadataURL() string {
+	if g.meta == nil {
+		return ""
+	}
+	return g.meta.URL
+}
+
+func (g *Generic) Status() Status {
+	if g.meta == nil {
+		var s Status
+		return s
+	}
+	return g.meta.Status()
+}
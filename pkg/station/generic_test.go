@@ -0,0 +1,47 @@
+package station
+
+import (
+	"testing"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+func TestGeneric(t *testing.T) {
+	g := NewGeneric("Plain", "http://example.com/stream", nil)
+	if s := g.Stream(); s.URL != "http://example.com/stream" || len(s.Sources) != 0 {
+		t.Errorf("Stream = %+v", s)
+	}
+	if u := g.MetadataURL(); u != "" {
+		t.Errorf("MetadataURL without metadata = %q", u)
+	}
+	if st := g.Status(); st != (Status{}) {
+		t.Errorf("Status without metadata = %+v", st)
+	}
+
+	fb := player.Source{URL: "http://example.com/low", Bitrate: 32}
+	g = NewGeneric("Fallback", "http://example.com/high", nil, fb)
+	s := g.Stream()
+	if s.URL != "http://example.com/high" || len(s.Sources) != 2 || s.Sources[1] != fb {
+		t.Errorf("Stream with a fallback = %+v", s)
+	}
+}
+
+// TestGenericMetadata checks that a station configured with paths shows the
+// same as the built in station using the same endpoint.
+func TestGenericMetadata(t *testing.T) {
+	srv := serveTestdata(t)
+	meta := &Metadata{
+		URL:    srv.URL + "/kfjc.json",
+		Show:   "$.air_name",
+		Artist: "$.artist",
+		Track:  "$.track_title",
+		Album:  "$.album",
+	}
+	g := NewGeneric("KFJC by config", "http://example.com/stream", meta)
+	if u := g.MetadataURL(); u != meta.URL {
+		t.Errorf("MetadataURL = %q, want %q", u, meta.URL)
+	}
+	if got, want := g.Status(), legacyJSON(t, "kfjc.json"); got != want {
+		t.Errorf("Status = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,391 @@
+package station
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+// hlsLiveSegments is how many segments from the end of a live playlist to
+// start playing at.
+const hlsLiveSegments = 3
+
+// hlsTimeout is how long a playlist or segment can take to fetch, so that a
+// stalled server ends the stream rather than silencing it for good.
+const hlsTimeout = 20 * time.Second
+
+// Variant is a stream listed in an HLS master playlist.
+type Variant struct {
+	URI       string
+	Bandwidth int
+	Codecs    string
+}
+
+// Segment is a media segment listed in an HLS media playlist.
+type Segment struct {
+	URI      string
+	Duration time.Duration
+	Title    string
+	// Seq is the segment's media sequence number.
+	Seq int
+	// ProgramTime is the wall clock time of the segment's first sample,
+	// from EXT-X-PROGRAM-DATE-TIME. It is zero if unknown.
+	ProgramTime time.Time
+}
+
+// Playlist is a parsed HLS playlist. A master playlist has Variants, and a
+// media playlist has Segments.
+type Playlist struct {
+	Variants       []Variant
+	Segments       []Segment
+	TargetDuration time.Duration
+	// Ended is set once the playlist will not grow any more.
+	Ended bool
+}
+
+// ParsePlaylist parses an HLS playlist. URIs in it are resolved against
+// base.
+func ParsePlaylist(r io.Reader, base *url.URL) (*Playlist, error) {
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() || strings.TrimSpace(sc.Text()) != "#EXTM3U" {
+		return nil, fmt.Errorf("not an HLS playlist")
+	}
+
+	pl := &Playlist{}
+	var (
+		seq     int
+		seg     Segment
+		variant *Variant
+		pdt     time.Time
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseAttrs(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bw, _ := strconv.Atoi(attrs["BANDWIDTH"])
+			variant = &Variant{Bandwidth: bw, Codecs: attrs["CODECS"]}
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			seq, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			secs, _ := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			pl.TargetDuration = time.Duration(secs) * time.Second
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			pdt, _ = time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			dur, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			secs, _ := strconv.ParseFloat(dur, 64)
+			seg.Duration = time.Duration(secs * float64(time.Second))
+			seg.Title = title
+		case line == "#EXT-X-ENDLIST":
+			pl.Ended = true
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments.
+		default:
+			uri, err := resolve(base, line)
+			if err != nil {
+				return nil, err
+			}
+			if variant != nil {
+				variant.URI = uri
+				pl.Variants = append(pl.Variants, *variant)
+				variant = nil
+				continue
+			}
+			seg.URI = uri
+			seg.Seq = seq
+			seg.ProgramTime = pdt
+			pl.Segments = append(pl.Segments, seg)
+			seq++
+			if !pdt.IsZero() {
+				// Later segments follow on, unless they have their own tag.
+				pdt = pdt.Add(seg.Duration)
+			}
+			seg = Segment{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
+
+// parseAttrs parses an attribute list like BANDWIDTH=128000,CODECS="mp4a.40.2".
+func parseAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		attrs[strings.TrimSpace(key)] = val
+		s = strings.TrimPrefix(rest, ",")
+	}
+	return attrs
+}
+
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("bad URI %q: %v", ref, err)
+	}
+	if base == nil {
+		return u.String(), nil
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// SelectVariant returns the variant with the highest bandwidth up to
+// maxBandwidth, or the lowest one if they are all higher. A maxBandwidth of
+// 0 means no limit.
+func SelectVariant(vs []Variant, maxBandwidth int) Variant {
+	sorted := append([]Variant(nil), vs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Bandwidth < sorted[j].Bandwidth })
+	best := sorted[0]
+	for _, v := range sorted {
+		if maxBandwidth == 0 || v.Bandwidth <= maxBandwidth {
+			best = v
+		}
+	}
+	return best
+}
+
+// HLS fetches an HLS stream and joins its segments into a single stream of
+// bytes that a player can read, keeping track of the stream's metadata as it
+// goes.
+type HLS struct {
+	url          string
+	maxBandwidth int
+	client       *http.Client
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewHLS returns a source for the playlist at url, which may be a master or
+// a media playlist. The variant with the most bandwidth up to maxBandwidth,
+// in bits per second, is played.
+func NewHLS(url string, maxBandwidth int) *HLS {
+	return &HLS{url: url, maxBandwidth: maxBandwidth, client: &http.Client{Timeout: hlsTimeout}}
+}
+
+// Status returns the metadata of the latest segment fetched.
+func (h *HLS) Status() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Open starts fetching the stream. Closing the returned reader stops it.
+func (h *HLS) Open() (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	go func() {
+		defer cancel()
+		pw.CloseWithError(h.run(ctx, pw))
+	}()
+	return &hlsReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+type hlsReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *hlsReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+func (h *HLS) fetchPlaylist(ctx context.Context, u string) (*Playlist, error) {
+	resp, err := h.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ParsePlaylist(resp.Body, resp.Request.URL)
+}
+
+func (h *HLS) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s failed: %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+func (h *HLS) run(ctx context.Context, w io.Writer) error {
+	pl, err := h.fetchPlaylist(ctx, h.url)
+	if err != nil {
+		return err
+	}
+	mediaURL := h.url
+	if len(pl.Variants) > 0 {
+		v := SelectVariant(pl.Variants, h.maxBandwidth)
+		log.Printf("hls: playing %d bps variant %s", v.Bandwidth, v.URI)
+		mediaURL = v.URI
+		if pl, err = h.fetchPlaylist(ctx, mediaURL); err != nil {
+			return err
+		}
+	}
+
+	last := liveStart(pl)
+	for {
+		if n := len(pl.Segments); n > 0 && pl.Segments[n-1].Seq < last {
+			// The server has reset or rewound its media sequence, so the
+			// segments we have played say nothing about these ones.
+			log.Printf("hls: media sequence went back from %d to %d", last, pl.Segments[n-1].Seq)
+			last = liveStart(pl)
+		}
+		fresh := false
+		for _, seg := range pl.Segments {
+			if seg.Seq <= last {
+				continue
+			}
+			if err := h.copySegment(ctx, w, seg); err != nil {
+				return err
+			}
+			last = seg.Seq
+			fresh = true
+		}
+		if pl.Ended {
+			return nil
+		}
+
+		// Reload after a target duration, or half that if the playlist had
+		// not changed, as the spec asks.
+		wait := pl.TargetDuration
+		if wait <= 0 {
+			wait = 5 * time.Second
+		}
+		if !fresh {
+			wait /= 2
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if pl, err = h.fetchPlaylist(ctx, mediaURL); err != nil {
+			return err
+		}
+	}
+}
+
+// liveStart returns the sequence number of the segment before the one to
+// start playing pl at: near the live edge rather than minutes behind, or the
+// first segment if the playlist has ended.
+func liveStart(pl *Playlist) int {
+	if pl.Ended || len(pl.Segments) <= hlsLiveSegments {
+		if len(pl.Segments) == 0 {
+			return -1
+		}
+		return pl.Segments[0].Seq - 1
+	}
+	return pl.Segments[len(pl.Segments)-hlsLiveSegments-1].Seq
+}
+
+// copySegment writes the segment's media to w, minus any ID3 tag, which is
+// read into the status instead.
+func (h *HLS) copySegment(ctx context.Context, w io.Writer, seg Segment) error {
+	resp, err := h.get(ctx, seg.URI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	tags, n := ParseID3(data)
+	h.mu.Lock()
+	if t := tags["TIT2"]; t != "" {
+		h.status.Track = t
+	} else if seg.Title != "" {
+		h.status.Track = seg.Title
+	}
+	if a := tags["TPE1"]; a != "" {
+		h.status.Artist = a
+	}
+	if a := tags["TALB"]; a != "" {
+		h.status.Album = a
+	}
+	h.status.ProgramTime = seg.ProgramTime
+	h.mu.Unlock()
+
+	_, err = w.Write(data[n:])
+	return err
+}
+
+// HLSStation is a station that streams over HLS.
+type HLSStation struct {
+	name string
+	logo image.Image
+	hls  *HLS
+}
+
+var _ Station = (*HLSStation)(nil)
+
+// NewHLSStation returns a station playing the HLS playlist at url. If logo is
+// nil, the generic radio logo is used.
+func NewHLSStation(name, url string, logo image.Image, maxBandwidth int) *HLSStation {
+	if logo == nil {
+		var err error
+		logo, _, err = image.Decode(bytes.NewReader(radioLogoBytes))
+		if err != nil {
+			log.Fatalf("Could not decode radio logo: %v", err)
+		}
+	}
+	return &HLSStation{name: name, logo: logo, hls: NewHLS(url, maxBandwidth)}
+}
+
+func (s *HLSStation) Name() string {
+	return s.name
+}
+
+func (s *HLSStation) Logo() image.Image {
+	return s.logo
+}
+
+func (s *HLSStation) Stream() player.Stream {
+	return player.Stream{Open: s.hls.Open}
+}
+
+func (s *HLSStation) Status() Status {
+	return s.hls.Status()
+}
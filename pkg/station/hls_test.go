@@ -0,0 +1,222 @@
+package station
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// id3Tag returns an ID3v2.3 tag holding ISO-8859-1 text frames.
+func id3Tag(frames map[string]string) []byte {
+	var body []byte
+	for id, text := range frames {
+		hdr := make([]byte, 10)
+		copy(hdr, id)
+		binary.BigEndian.PutUint32(hdr[4:], uint32(1+len(text)))
+		body = append(body, hdr...)
+		body = append(body, 0)
+		body = append(body, text...)
+	}
+	n := len(body)
+	tag := []byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(tag, body...)
+}
+
+func TestParsePlaylist(t *testing.T) {
+	base, _ := url.Parse("http://example.com/live/master.m3u8")
+
+	master := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.5"
+lo/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=256000,CODECS="mp4a.40.2"
+http://cdn.example.com/hi/index.m3u8
+`
+	pl, err := ParsePlaylist(strings.NewReader(master), base)
+	if err != nil {
+		t.Fatalf("ParsePlaylist failed: %v", err)
+	}
+	want := []Variant{
+		{URI: "http://example.com/live/lo/index.m3u8", Bandwidth: 64000, Codecs: "mp4a.40.5"},
+		{URI: "http://cdn.example.com/hi/index.m3u8", Bandwidth: 256000, Codecs: "mp4a.40.2"},
+	}
+	if fmt.Sprint(pl.Variants) != fmt.Sprint(want) {
+		t.Errorf("Variants = %v, want %v", pl.Variants, want)
+	}
+	for _, c := range []struct {
+		max  int
+		want int
+	}{
+		{0, 256000},
+		{128000, 64000},
+		{256000, 256000},
+		{1000, 64000},
+	} {
+		if got := SelectVariant(pl.Variants, c.max).Bandwidth; got != c.want {
+			t.Errorf("SelectVariant(%d) = %d, want %d", c.max, got, c.want)
+		}
+	}
+
+	media := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:42
+#EXT-X-PROGRAM-DATE-TIME:2024-03-01T12:00:00Z
+#EXTINF:10.0,First
+seg42.aac
+#EXTINF:9.5,
+seg43.aac
+#EXT-X-ENDLIST
+`
+	pl, err = ParsePlaylist(strings.NewReader(media), base)
+	if err != nil {
+		t.Fatalf("ParsePlaylist failed: %v", err)
+	}
+	if !pl.Ended || pl.TargetDuration != 10*time.Second || len(pl.Segments) != 2 {
+		t.Fatalf("ParsePlaylist = %+v", pl)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	wantSegs := []Segment{
+		{URI: "http://example.com/live/seg42.aac", Duration: 10 * time.Second, Title: "First", Seq: 42, ProgramTime: start},
+		{URI: "http://example.com/live/seg43.aac", Duration: 9500 * time.Millisecond, Seq: 43, ProgramTime: start.Add(10 * time.Second)},
+	}
+	for i, seg := range pl.Segments {
+		if seg != wantSegs[i] {
+			t.Errorf("Segments[%d] = %+v, want %+v", i, seg, wantSegs[i])
+		}
+	}
+
+	if _, err := ParsePlaylist(strings.NewReader("<html>"), base); err == nil {
+		t.Errorf("ParsePlaylist of HTML succeeded")
+	}
+}
+
+func TestHLSServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=256000\nhi.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=64000\nlo.m3u8\n")
+	})
+	mux.HandleFunc("/hi.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("fetched the variant over maxBandwidth")
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/lo.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:7\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2024-03-01T12:00:00Z\n"+
+			"#EXTINF:1,\nseg7.aac\n#EXTINF:1,Fallback Title\nseg8.aac\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/seg7.aac", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(append(id3Tag(map[string]string{"TIT2": "Song", "TPE1": "Band", "TALB": "Record"}), "seven;"...))
+	})
+	mux.HandleFunc("/seg8.aac", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("eight;"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	h := NewHLS(srv.URL+"/master.m3u8", 128000)
+	rc, err := h.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading stream failed: %v", err)
+	}
+	if string(got) != "seven;eight;" {
+		t.Errorf("stream = %q, want the segments without their ID3 tags", got)
+	}
+
+	st := h.Status()
+	if st.Track != "Fallback Title" || st.Artist != "Band" || st.Album != "Record" {
+		t.Errorf("Status = %+v, want the ID3 tags, then the EXTINF title", st)
+	}
+	if want := time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC); !st.ProgramTime.Equal(want) {
+		t.Errorf("ProgramTime = %v, want %v", st.ProgramTime, want)
+	}
+}
+
+// TestHLSSequenceReset checks that a live stream carries on after the server
+// restarts its media sequence from a lower number.
+func TestHLSSequenceReset(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		loads int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		loads++
+		n := loads
+		mu.Unlock()
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n")
+		switch n {
+		case 1:
+			fmt.Fprint(w, "#EXT-X-MEDIA-SEQUENCE:100\n")
+			for i := 100; i < 105; i++ {
+				fmt.Fprintf(w, "#EXTINF:1,\nseg?n=a%d\n", i)
+			}
+		case 2:
+			fmt.Fprint(w, "#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nseg?n=b0\n#EXTINF:1,\nseg?n=b1\n")
+		default:
+			fmt.Fprint(w, "#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nseg?n=b0\n#EXTINF:1,\nseg?n=b1\n#EXTINF:1,\nseg?n=b2\n#EXT-X-ENDLIST\n")
+		}
+	})
+	mux.HandleFunc("/seg", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.FormValue("n")+";")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	rc, err := NewHLS(srv.URL+"/live.m3u8", 0).Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading stream failed: %v", err)
+	}
+	// The first load starts near the live edge.
+	if want := "a102;a103;a104;b0;b1;b2;"; string(got) != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+}
+
+// TestHLSStalledSegment checks that a segment that never arrives ends the
+// stream with an error, rather than leaving it silent.
+func TestHLSStalledSegment(t *testing.T) {
+	stall := make(chan struct{})
+	defer close(stall)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nseg\n")
+	})
+	mux.HandleFunc("/seg", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	h := NewHLS(srv.URL+"/live.m3u8", 0)
+	h.client = &http.Client{Timeout: 100 * time.Millisecond}
+	rc, err := h.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err == nil {
+		t.Errorf("reading a stalled stream succeeded")
+	}
+}
@@ -0,0 +1,97 @@
+package station
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// ParseID3 reads the text frames, like TIT2 and TPE1, of the ID3v2 tag at the
+// start of data, as HLS audio segments carry. It returns the frames and the
+// length of the tag, which is 0 if there is none.
+func ParseID3(data []byte) (map[string]string, int) {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return nil, 0
+	}
+	version := data[3]
+	size := 10 + syncsafe(data[6:10])
+	if data[5]&0x10 != 0 {
+		// Footer.
+		size += 10
+	}
+	if size > len(data) {
+		return nil, 0
+	}
+
+	if version < 3 {
+		// ID3v2.2 has shorter frame headers, and is rare enough to skip.
+		return nil, size
+	}
+	tags := make(map[string]string)
+	frames := data[10:size]
+	if data[5]&0x40 != 0 && len(frames) >= 4 {
+		// Skip the extended header. Its size includes itself in v2.4, but
+		// not in v2.3.
+		ext := syncsafe(frames[:4])
+		if version == 3 {
+			ext = int(binary.BigEndian.Uint32(frames[:4])) + 4
+		}
+		if ext > len(frames) {
+			return nil, size
+		}
+		frames = frames[ext:]
+	}
+	for len(frames) >= 10 && frames[0] != 0 {
+		id := string(frames[:4])
+		var n int
+		if version >= 4 {
+			n = syncsafe(frames[4:8])
+		} else {
+			n = int(binary.BigEndian.Uint32(frames[4:8]))
+		}
+		if n < 0 || 10+n > len(frames) {
+			break
+		}
+		if strings.HasPrefix(id, "T") && n > 0 {
+			tags[id] = decodeID3Text(frames[10 : 10+n])
+		}
+		frames = frames[10+n:]
+	}
+	return tags, size
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// decodeID3Text decodes a text frame, whose first byte is its encoding.
+func decodeID3Text(b []byte) string {
+	enc, b := b[0], b[1:]
+	var s string
+	switch enc {
+	case 0:
+		// ISO-8859-1.
+		rs := make([]rune, len(b))
+		for i, c := range b {
+			rs[i] = rune(c)
+		}
+		s = string(rs)
+	case 1, 2:
+		// UTF-16, with a BOM for 1 and big endian for 2.
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			b = b[2:]
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = order.Uint16(b[2*i:])
+		}
+		s = string(utf16.Decode(u))
+	default:
+		s = string(b)
+	}
+	return strings.TrimRight(s, "\x00")
+}
@@ -3,23 +3,27 @@ package station
 import (
 	"bytes"
 	_ "embed"
-	"encoding/json"
 	"image"
 	_ "image/gif"
-	"io"
 	"log"
-	"net/http"
-	"os/exec"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/kfjc-devil.gif
 var kfjcLogoBytes []byte
 
-type kfjcStatus struct {
-	AirName    string `json:"air_name"`
-	Album      string `json:"album"`
-	Artist     string `json:"artist"`
-	TrackTitle string `json:"track_title"`
+// kfjcMetadataURL is where the station's Status comes from. It has the DJ on
+// air and the track playing, but not when the show ends or what is next, so
+// the Status has no Start, End or Next.
+const kfjcMetadataURL = "https://kfjc.org/api/playlists/current.php"
+
+var kfjcMetadata = Metadata{
+	URL:    kfjcMetadataURL,
+	Show:   "air_name",
+	Artist: "artist",
+	Track:  "track_title",
+	Album:  "album",
 }
 
 type Kfjc struct {
@@ -27,11 +31,12 @@ type Kfjc struct {
 }
 
 var _ Station = (*Kfjc)(nil)
+var _ Metadater = (*Kfjc)(nil)
 
 func NewKfjc() *Kfjc {
 	logo, _, err := image.Decode(bytes.NewReader(kfjcLogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode KFJC logo: %w", err)
+		log.Fatalf("Could not decode KFJC logo: %v", err)
 	}
 
 	return &Kfjc{
@@ -47,36 +52,17 @@ func (kfjc *Kfjc) Logo() image.Image {
 	return kfjc.logo
 }
 
-func (kfjc *Kfjc) StreamCmd() *exec.Cmd {
-	str := "http://netcast.kfjc.org/kfjc-320k-aac"
-	return exec.Command("mpv", "-no-video", str)
+func (kfjc *Kfjc) Stream() player.Stream {
+	return player.FromSources(
+		player.Source{URL: "http://netcast.kfjc.org/kfjc-320k-aac", Bitrate: 320},
+		player.Source{URL: "http://netcast.kfjc.org/kfjc-128k-mp3", Bitrate: 128},
+	)
 }
 
-func (kfjc *Kfjc) Status() Status {
-	var s Status
-
-	resp, err := http.Get("https://kfjc.org/api/playlists/current.php")
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-
-	var ks kfjcStatus
-	if err := json.Unmarshal(body, &ks); err != nil {
-		s.Show = err.Error()
-		return s
-	}
+func (kfjc *Kfjc) MetadataURL() string {
+	return kfjcMetadataURL
+}
 
-	return Status{
-		Show:   ks.AirName,
-		Album:  ks.Album,
-		Artist: ks.Artist,
-		Track:  ks.TrackTitle,
-	}
+func (kfjc *Kfjc) Status() Status {
+	return kfjcMetadata.Status()
 }
@@ -6,7 +6,8 @@ import (
 	"image"
 	_ "image/gif"
 	"log"
-	"os/exec"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/kxlu.gif
@@ -28,7 +29,7 @@ var _ Station = (*Kxlu)(nil)
 func NewKxlu() *Kxlu {
 	logo, _, err := image.Decode(bytes.NewReader(kxluLogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode KXLU logo: %w", err)
+		log.Fatalf("Could not decode KXLU logo: %v", err)
 	}
 
 	return &Kxlu{
@@ -44,9 +45,8 @@ func (kxlu *Kxlu) Logo() image.Image {
 	return kxlu.logo
 }
 
-func (kxlu *Kxlu) StreamCmd() *exec.Cmd {
-	str := "http://kxlu.streamguys1.com/kxlu-hi"
-	return exec.Command("mpv", "-no-video", str)
+func (kxlu *Kxlu) Stream() player.Stream {
+	return player.Stream{URL: "http://kxlu.streamguys1.com/kxlu-hi"}
 }
 
 func (kxlu *Kxlu) Status() Status {
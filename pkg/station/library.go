@@ -0,0 +1,124 @@
+package station
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"io/fs"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+//go:embed images/library.gif
+var libraryLogoBytes []byte
+
+// audioExts are the file extensions that the library plays.
+var audioExts = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".ogg":  true,
+	".opus": true,
+	".m4a":  true,
+	".aac":  true,
+	".wav":  true,
+}
+
+// Library plays the audio files in a local directory, so that the radio
+// keeps working without the internet.
+type Library struct {
+	dir     string
+	shuffle bool
+	logo    image.Image
+
+	mu     sync.Mutex
+	tracks []string
+	cur    int
+}
+
+var _ Station = (*Library)(nil)
+var _ Skipper = (*Library)(nil)
+var _ Local = (*Library)(nil)
+
+// NewLibrary returns a station playing the files under dir, in order of
+// their paths or shuffled.
+func NewLibrary(dir string, shuffle bool) *Library {
+	logo, _, err := image.Decode(bytes.NewReader(libraryLogoBytes))
+	if err != nil {
+		log.Fatalf("Could not decode Library logo: %v", err)
+	}
+
+	return &Library{
+		dir:     dir,
+		shuffle: shuffle,
+		logo:    logo,
+	}
+}
+
+func (l *Library) Name() string {
+	return "Library"
+}
+
+func (l *Library) Logo() image.Image {
+	return l.logo
+}
+
+// Stream rescans the directory, so that new files are picked up each time
+// the station is tuned to.
+func (l *Library) Stream() player.Stream {
+	var tracks []string
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && audioExts[strings.ToLower(filepath.Ext(path))] {
+			tracks = append(tracks, path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("scanning library %s failed: %v", l.dir, err)
+	}
+	sort.Strings(tracks)
+	if l.shuffle {
+		rand.Shuffle(len(tracks), func(i, j int) { tracks[i], tracks[j] = tracks[j], tracks[i] })
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tracks = tracks
+	l.cur = 0
+	return player.Stream{Playlist: tracks}
+}
+
+func (l *Library) Local() bool {
+	return true
+}
+
+func (l *Library) SetTrack(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cur = i
+}
+
+func (l *Library) Status() Status {
+	l.mu.Lock()
+	if l.cur < 0 || l.cur >= len(l.tracks) {
+		l.mu.Unlock()
+		return Status{Show: "No music in " + l.dir}
+	}
+	path := l.tracks[l.cur]
+	show := fmt.Sprintf("%d/%d", l.cur+1, len(l.tracks))
+	l.mu.Unlock()
+
+	st := ReadTags(path)
+	st.Show = show
+	return st
+}
@@ -0,0 +1,227 @@
+package station
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// Metadata fetches a station's Status from a now playing endpoint, picking
+// each field out of the JSON or XML it returns with a path. Stations whose
+// endpoint is that simple need nothing else.
+//
+// JSON paths are like "$.now.show" or "items[0].title", with or without the
+// "$.". XML paths are like "/wmbrinfo/showname", "item[2]/title" or
+// "track/@title", where indexes count from 1. Fields whose path is empty, or
+// finds nothing, are left empty.
+type Metadata struct {
+	URL string
+	// XML is true if the endpoint returns XML rather than JSON.
+	XML bool
+	// ASCII drops the characters that the screen's font does not have.
+	ASCII bool
+
+	Show   string
+	Artist string
+	Track  string
+	Album  string
+}
+
+// nonASCII matches the characters dropped by Metadata.ASCII.
+var nonASCII = regexp.MustCompile("[[:^ascii:]]")
+
+// Status fetches and parses the metadata. Errors are shown in place of the
+// show.
+func (m Metadata) Status() Status {
+	resp, err := http.Get(m.URL)
+	if err != nil {
+		return ErrStatus(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ErrStatus(fmt.Errorf("GET %s failed: %s", m.URL, resp.Status))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrStatus(err)
+	}
+
+	s, err := m.Parse(body)
+	if err != nil {
+		return ErrStatus(err)
+	}
+	return s
+}
+
+// Parse picks the Status out of a response from the endpoint.
+func (m Metadata) Parse(body []byte) (Status, error) {
+	var find func(path string) string
+	if m.XML {
+		root, err := parseXMLTree(body)
+		if err != nil {
+			return Status{}, err
+		}
+		find = root.find
+	} else {
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(body))
+		// Keep numbers as they were written.
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return Status{}, err
+		}
+		find = func(path string) string { return findJSON(v, path) }
+	}
+
+	get := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		s := find(path)
+		if m.ASCII {
+			s = nonASCII.ReplaceAllLiteralString(s, "")
+		}
+		return s
+	}
+	return Status{
+		Show:   get(m.Show),
+		Artist: get(m.Artist),
+		Track:  get(m.Track),
+		Album:  get(m.Album),
+	}, nil
+}
+
+// findJSON returns the string, number or bool at path in v, which was
+// decoded from JSON.
+func findJSON(v interface{}, path string) string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			v = x[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return ""
+			}
+			v = x[i]
+		default:
+			return ""
+		}
+	}
+	switch x := v.(type) {
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return ""
+}
+
+// xmlNode is an element of an XML document.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+// parseXMLTree parses an XML document into a tree of its elements, with a
+// root node above the document's own.
+func parseXMLTree(body []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charsetReader
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, fmt.Errorf("no XML elements")
+	}
+	return root, nil
+}
+
+// find returns the text of the element, or the attribute, at path below n.
+func (n *xmlNode) find(path string) string {
+	steps := strings.Split(strings.Trim(path, "/"), "/")
+	for i, step := range steps {
+		if strings.HasPrefix(step, "@") && i == len(steps)-1 {
+			for _, a := range n.attrs {
+				if a.Name.Local == step[1:] {
+					return a.Value
+				}
+			}
+			return ""
+		}
+		name, idx := step, 1
+		if j := strings.Index(step, "["); j >= 0 && strings.HasSuffix(step, "]") {
+			var err error
+			name = step[:j]
+			if idx, err = strconv.Atoi(step[j+1 : len(step)-1]); err != nil {
+				return ""
+			}
+		}
+		var next *xmlNode
+		for _, c := range n.children {
+			if c.name != name {
+				continue
+			}
+			if idx--; idx == 0 {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return ""
+		}
+		n = next
+	}
+	return n.text
+}
+
+// charsetReader decodes XML in the charsets that stations use, which the
+// xml package only does for UTF-8.
+func charsetReader(charset string, reader io.Reader) (io.Reader, error) {
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil {
+		return nil, fmt.Errorf("charset %s: %s", charset, err.Error())
+	}
+	if enc == nil {
+		// Assume it's compatible with (a subset of) UTF-8 encoding
+		// Bug: https://github.com/golang/go/issues/19421
+		return reader, nil
+	}
+	return enc.NewDecoder().Reader(reader), nil
+}
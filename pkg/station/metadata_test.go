@@ -0,0 +1,181 @@
+package station
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveTestdata serves the files in testdata, and a 500 from /broken.
+func serveTestdata(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir("testdata")))
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// legacyJSON is how KFJC and Aporee decoded their metadata before
+// Metadata replaced them.
+func legacyJSON(t *testing.T, file string) Status {
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch file {
+	case "kfjc.json":
+		var ks struct {
+			AirName    string `json:"air_name"`
+			Album      string `json:"album"`
+			Artist     string `json:"artist"`
+			TrackTitle string `json:"track_title"`
+		}
+		if err := json.Unmarshal(data, &ks); err != nil {
+			t.Fatal(err)
+		}
+		return Status{Show: ks.AirName, Album: ks.Album, Artist: ks.Artist, Track: ks.TrackTitle}
+	case "aporee.json":
+		var as struct {
+			Lat   string `json:"aporee_lat"`
+			Lng   string `json:"aporee_lng"`
+			Title string `json:"aporee_title"`
+		}
+		if err := json.Unmarshal(data, &as); err != nil {
+			t.Fatal(err)
+		}
+		return Status{Show: as.Title, Track: as.Lat, Album: as.Lng}
+	}
+	t.Fatalf("no legacy decoder for %s", file)
+	return Status{}
+}
+
+// TestStationMetadata fetches each station's metadata from a fixture of its
+// endpoint, and checks it against what the station showed before.
+func TestStationMetadata(t *testing.T) {
+	srv := serveTestdata(t)
+	for _, c := range []struct {
+		name string
+		meta Metadata
+		file string
+		want Status
+	}{
+		{"KFJC", kfjcMetadata, "kfjc.json", legacyJSON(t, "kfjc.json")},
+		{"Aporee", aporeeMetadata, "aporee.json", legacyJSON(t, "aporee.json")},
+		{
+			// The old code put the title in Artist by mistake.
+			name: "WFMU",
+			meta: wfmuMetadata,
+			file: "wfmu.json",
+			want: Status{
+				Show:   "Transpacific Sound Paradise with Rob Weisberg",
+				Artist: "Tsegue-Maryam Guebrou",
+				Track:  "The Homeless Wanderer",
+				Album:  "Ethiopiques 21",
+			},
+		},
+		{
+			// The old code never found the hosts, because of a broken
+			// struct tag. The degree sign is not in the screen's font.
+			name: "WMBR",
+			meta: wmbrMetadata,
+			file: "wmbr.xml",
+			want: Status{
+				Show:   "Cafe Society",
+				Artist: "Renee",
+				Track:  "44F",
+				Album:  "Light Rain",
+			},
+		},
+	} {
+		m := c.meta
+		m.URL = srv.URL + "/" + c.file
+		if got := m.Status(); got != c.want {
+			t.Errorf("%s: Status = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMetadataStatusErrors(t *testing.T) {
+	srv := serveTestdata(t)
+	for _, c := range []struct {
+		meta Metadata
+		want string
+	}{
+		{Metadata{URL: srv.URL + "/broken", Show: "show"}, "500 Internal Server Error"},
+		{Metadata{URL: srv.URL + "/wmbr.xml", Show: "show"}, "invalid character"},
+		{Metadata{URL: srv.URL + "/kfjc.json", XML: true, Show: "show"}, "XML"},
+	} {
+		if got := c.meta.Status(); !got.Failed || !strings.Contains(got.Show, c.want) {
+			t.Errorf("Status of %s = %+v, want an error mentioning %q", c.meta.URL, got, c.want)
+		}
+	}
+}
+
+func TestParseJSONPaths(t *testing.T) {
+	body := `{
+		"now": {"show": "Morning", "hosts": ["Ann", "Bo"]},
+		"tracks": [{"title": "Old"}, {"title": "New", "year": 1971, "live": false}]
+	}`
+	for _, c := range []struct {
+		path, want string
+	}{
+		{"now.show", "Morning"},
+		{"$.now.show", "Morning"},
+		{"$.now.hosts[1]", "Bo"},
+		{"tracks[1].title", "New"},
+		{"tracks.1.title", "New"},
+		{"tracks[1].year", "1971"},
+		{"tracks[1].live", "false"},
+		{"tracks[2].title", ""},
+		{"tracks[-1].title", ""},
+		{"now", ""},
+		{"now.show.name", ""},
+		{"missing", ""},
+	} {
+		st, err := Metadata{Show: c.path}.Parse([]byte(body))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if st.Show != c.want {
+			t.Errorf("path %q = %q, want %q", c.path, st.Show, c.want)
+		}
+	}
+}
+
+func TestParseXMLPaths(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<playlist station="KXYZ">
+	<track title="First"><artist>One</artist></track>
+	<track title="Second"><artist>Two</artist></track>
+	<show>Late Night</show>
+</playlist>`
+	for _, c := range []struct {
+		path, want string
+	}{
+		{"/playlist/show", "Late Night"},
+		{"playlist/show", "Late Night"},
+		{"/playlist/@station", "KXYZ"},
+		{"/playlist/track/artist", "One"},
+		{"/playlist/track[2]/artist", "Two"},
+		{"/playlist/track[2]/@title", "Second"},
+		{"/playlist/track[3]/@title", ""},
+		{"/playlist/track[x]/@title", ""},
+		{"/playlist/show/@missing", ""},
+		{"/other/show", ""},
+	} {
+		st, err := Metadata{XML: true, Show: c.path}.Parse([]byte(body))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if st.Show != c.want {
+			t.Errorf("path %q = %q, want %q", c.path, st.Show, c.want)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os/exec"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/nts1.gif
@@ -34,29 +36,54 @@ type ntsEmbeds struct {
 }
 
 type ntsShow struct {
+	Title  string    `json:"broadcast_title"`
+	Start  string    `json:"start_timestamp"`
+	End    string    `json:"end_timestamp"`
 	Embeds ntsEmbeds `json:"embeds"`
 }
 
 type ntsResult struct {
-	Now ntsShow `json:"now"`
+	Now  ntsShow `json:"now"`
+	Next ntsShow `json:"next"`
 }
 
 type ntsStatus struct {
 	Results []ntsResult `json:"results"`
 }
 
+// ntsEpisode is an archived episode, as listed by the NTS API.
+type ntsEpisode struct {
+	Name         string `json:"name"`
+	Location     string `json:"location_long"`
+	Broadcast    string `json:"broadcast"`
+	Mixcloud     string `json:"mixcloud"`
+	AudioSources []struct {
+		URL string `json:"url"`
+	} `json:"audio_sources"`
+}
+
+type ntsEpisodes struct {
+	Results []ntsEpisode `json:"results"`
+}
+
+// ntsMetadataURL is where the station's Status comes from.
+const ntsMetadataURL = "https://www.nts.live/api/v2/live"
+
 type Nts struct {
 	channel int
 	logo    image.Image
 	stream  string
+	archive episodeCache
 }
 
 var _ Station = (*Nts)(nil)
+var _ Metadater = (*Nts)(nil)
+var _ Archiver = (*Nts)(nil)
 
 func NewNts1() *Nts {
 	logo, _, err := image.Decode(bytes.NewReader(nts1LogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode NTS1 logo: %w", err)
+		log.Fatalf("Could not decode NTS1 logo: %v", err)
 	}
 
 	return &Nts{
@@ -69,7 +96,7 @@ func NewNts1() *Nts {
 func NewNts2() *Nts {
 	logo, _, err := image.Decode(bytes.NewReader(nts2LogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode NTS2 logo: %w", err)
+		log.Fatalf("Could not decode NTS2 logo: %v", err)
 	}
 
 	return &Nts{
@@ -87,46 +114,111 @@ func (nts *Nts) Logo() image.Image {
 	return nts.logo
 }
 
-func (nts *Nts) StreamCmd() *exec.Cmd {
-	return exec.Command("mpv", "-no-video", nts.stream)
+func (nts *Nts) Stream() player.Stream {
+	return player.Stream{URL: nts.stream}
+}
+
+func (nts *Nts) MetadataURL() string {
+	return ntsMetadataURL
 }
 
 func (nts *Nts) Status() Status {
 	var s Status
 
-	resp, err := http.Get("https://www.nts.live/api/v2/live")
+	resp, err := http.Get(ntsMetadataURL)
 	if err != nil {
-		s.Show = err.Error()
-		return s
+		return ErrStatus(err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		s.Show = err.Error()
-		return s
+		return ErrStatus(err)
 	}
 
 	var ns ntsStatus
 	if err := json.Unmarshal(body, &ns); err != nil {
-		s.Show = err.Error()
-		return s
+		return ErrStatus(err)
 	}
 
 	if len(ns.Results) < 2 {
 		s.Show = "Not enough results"
+		s.Failed = true
 		return s
 	}
 
-	dets := ns.Results[nts.channel-1].Now.Embeds.Details
+	res := ns.Results[nts.channel-1]
+	dets := res.Now.Embeds.Details
 	var genre string
 	if len(dets.Genres) > 0 {
 		genre = dets.Genres[0].Value
 	}
 
+	next := res.Next.Embeds.Details.Name
+	if next == "" {
+		next = res.Next.Title
+	}
+
 	return Status{
 		Show:   dets.Name,
 		Artist: "",
 		Track:  dets.Location,
 		Album:  genre,
+		Start:  parseNtsTime(res.Now.Start),
+		End:    parseNtsTime(res.Now.End),
+		Next:   next,
+	}
+}
+
+// Episodes returns the episodes most recently added to the NTS archive. The
+// archive is shared by both channels.
+func (nts *Nts) Episodes() ([]Episode, error) {
+	return nts.archive.get(func() ([]Episode, error) {
+		resp, err := http.Get("https://www.nts.live/api/v2/collections/recently-added")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("NTS archive failed: %s", resp.Status)
+		}
+		var ne ntsEpisodes
+		if err := json.NewDecoder(resp.Body).Decode(&ne); err != nil {
+			return nil, err
+		}
+
+		var eps []Episode
+		for _, e := range ne.Results {
+			// Episodes are streamed from Mixcloud or Soundcloud.
+			url := e.Mixcloud
+			if url == "" && len(e.AudioSources) > 0 {
+				url = e.AudioSources[0].URL
+			}
+			if url == "" {
+				continue
+			}
+			eps = append(eps, Episode{
+				ID:    url,
+				Show:  e.Name,
+				Title: e.Location,
+				Aired: parseNtsTime(e.Broadcast),
+			})
+		}
+		return eps, nil
+	})
+}
+
+// EpisodeStream plays an episode from Mixcloud or Soundcloud, which mpv
+// does with yt-dlp.
+func (nts *Nts) EpisodeStream(ep Episode) (player.Stream, error) {
+	return player.Stream{URL: ep.ID}, nil
+}
+
+// parseNtsTime parses an NTS timestamp, returning the zero time if it is
+// missing or malformed.
+func parseNtsTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
 	}
+	return t
 }
@@ -2,7 +2,9 @@ package station
 
 import (
 	"image"
-	"os/exec"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 var AllStations = []Station{
@@ -21,14 +23,81 @@ type Station interface {
 
 	Logo() image.Image
 
-	StreamCmd() *exec.Cmd
+	Stream() player.Stream
 
 	Status() Status
 }
 
+// Metadater is implemented by stations that fetch their Status from a
+// metadata endpoint, so that the endpoint can be checked.
+type Metadater interface {
+	MetadataURL() string
+}
+
+// Local is implemented by stations that play from the radio itself, like the
+// library, rather than from a stream. Their Stream method may change what
+// they play next, so health checks leave them alone.
+type Local interface {
+	// Local reports whether the station plays from the radio itself.
+	Local() bool
+}
+
+// Skipper is implemented by stations made of separate tracks, like the
+// library. Left and right skip between their tracks rather than stations.
+type Skipper interface {
+	// SetTrack tells the station which entry of its playlist is playing.
+	SetTrack(i int)
+}
+
+// Resumer is implemented by stations that remember how far through what they
+// play the listener got, like podcasts.
+type Resumer interface {
+	// SetPosition tells the station the position in, and length of, what is
+	// playing.
+	SetPosition(pos, length time.Duration)
+}
+
 type Status struct {
 	Show   string
 	Album  string
 	Artist string
 	Track  string
+
+	// Start and End are the scheduled times of the current show. They are
+	// zero if the station does not publish a schedule.
+	Start time.Time
+	End   time.Time
+
+	// Next is the name of the show that is up next, if known.
+	Next string
+
+	// ProgramTime is when the latest audio fetched was broadcast, for
+	// streams like HLS that say so. It is zero otherwise.
+	ProgramTime time.Time
+
+	// Failed is set if the metadata could not be fetched, in which case
+	// Show says why, for the screen. It is not what is playing.
+	Failed bool
+}
+
+// ErrStatus returns the status of a station whose metadata could not be
+// fetched.
+func ErrStatus(err error) Status {
+	return Status{Show: err.Error(), Failed: true}
+}
+
+// Progress returns how far through the current show we are at time now, as a
+// fraction between 0 and 1. It returns false if the show times are unknown.
+func (s Status) Progress(now time.Time) (float64, bool) {
+	if s.Start.IsZero() || !s.End.After(s.Start) {
+		return 0, false
+	}
+	p := float64(now.Sub(s.Start)) / float64(s.End.Sub(s.Start))
+	if p < 0 {
+		p = 0
+	}
+	if p > 1 {
+		p = 1
+	}
+	return p, true
 }
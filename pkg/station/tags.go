@@ -0,0 +1,132 @@
+package station
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadTags returns the title, artist and album of an audio file as a Status.
+// Tags are read from MP3 ID3v2 tags and FLAC Vorbis comments. Anything
+// missing is guessed from the file name, like "Artist - Title.mp3", and
+// the name of its directory, for the album.
+func ReadTags(path string) Status {
+	var st Status
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		st = readID3File(path)
+	case ".flac":
+		st = readFlacFile(path)
+	}
+
+	if st.Track == "" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if artist, title, ok := strings.Cut(name, " - "); ok && st.Artist == "" {
+			st.Artist, st.Track = artist, title
+		} else {
+			st.Track = name
+		}
+	}
+	if st.Album == "" {
+		st.Album = filepath.Base(filepath.Dir(path))
+	}
+	return st
+}
+
+func readID3File(path string) Status {
+	f, err := os.Open(path)
+	if err != nil {
+		return Status{}
+	}
+	defer f.Close()
+	hdr := make([]byte, 10)
+	if _, err := io.ReadFull(f, hdr); err != nil || string(hdr[:3]) != "ID3" {
+		return Status{}
+	}
+	data := make([]byte, 10+syncsafe(hdr[6:10]))
+	copy(data, hdr)
+	if _, err := io.ReadFull(f, data[10:]); err != nil {
+		return Status{}
+	}
+	tags, _ := ParseID3(data)
+	return Status{Track: tags["TIT2"], Artist: tags["TPE1"], Album: tags["TALB"]}
+}
+
+// flacVorbisComment is the type of the FLAC metadata block with the tags.
+const flacVorbisComment = 4
+
+func readFlacFile(path string) Status {
+	f, err := os.Open(path)
+	if err != nil {
+		return Status{}
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != "fLaC" {
+		return Status{}
+	}
+	for {
+		hdr := make([]byte, 4)
+		if _, err := io.ReadFull(f, hdr); err != nil {
+			return Status{}
+		}
+		last, typ := hdr[0]&0x80 != 0, hdr[0]&0x7f
+		n := int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+		if typ != flacVorbisComment {
+			if last {
+				return Status{}
+			}
+			if _, err := f.Seek(int64(n), io.SeekCurrent); err != nil {
+				return Status{}
+			}
+			continue
+		}
+		block := make([]byte, n)
+		if _, err := io.ReadFull(f, block); err != nil {
+			return Status{}
+		}
+		c := ParseVorbisComment(block)
+		return Status{Track: c["TITLE"], Artist: c["ARTIST"], Album: c["ALBUM"]}
+	}
+}
+
+// ParseVorbisComment parses a Vorbis comment block, as found in FLAC and Ogg
+// files, into fields keyed by their upper case names.
+func ParseVorbisComment(b []byte) map[string]string {
+	r := bytes.NewReader(b)
+	readString := func() (string, bool) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil || int(n) > r.Len() {
+			return "", false
+		}
+		s := make([]byte, n)
+		r.Read(s)
+		return string(s), true
+	}
+
+	fields := make(map[string]string)
+	if _, ok := readString(); !ok {
+		// No vendor string.
+		return fields
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return fields
+	}
+	for i := uint32(0); i < count; i++ {
+		s, ok := readString()
+		if !ok {
+			break
+		}
+		if k, v, ok := strings.Cut(s, "="); ok {
+			k = strings.ToUpper(k)
+			if _, dup := fields[k]; !dup {
+				fields[k] = v
+			}
+		}
+	}
+	return fields
+}
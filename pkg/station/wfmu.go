@@ -3,35 +3,58 @@ package station
 import (
 	"bytes"
 	_ "embed"
-	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"image"
 	_ "image/gif"
-	"io"
 	"log"
 	"net/http"
-	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
 )
 
 //go:embed images/wfmu.gif
 var wfmuLogoBytes []byte
 
-type wfmuStatus struct {
-	Show   string `json:"show"`
-	Album  string `json:"album"`
-	Artist string `json:"artist"`
-	Title  string `json:"title"`
+// wfmuArchiveFeed is the RSS feed of WFMU's newly archived shows.
+type wfmuArchiveFeed struct {
+	Items []struct {
+		Title     string `xml:"title"`
+		PubDate   string `xml:"pubDate"`
+		Enclosure struct {
+			URL string `xml:"url,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+}
+
+// wfmuMetadataURL is where the station's Status comes from. It only has the
+// show and track playing, with no show times or next show, so the Status has
+// no Start, End or Next.
+const wfmuMetadataURL = "https://wfmu.org/wp-content/themes/wfmu-theme/status/main.json"
+
+var wfmuMetadata = Metadata{
+	URL:    wfmuMetadataURL,
+	Show:   "show",
+	Artist: "artist",
+	Track:  "title",
+	Album:  "album",
 }
 
 type Wfmu struct {
-	logo image.Image
+	logo    image.Image
+	archive episodeCache
 }
 
 var _ Station = (*Wfmu)(nil)
+var _ Metadater = (*Wfmu)(nil)
+var _ Archiver = (*Wfmu)(nil)
 
 func NewWfmu() *Wfmu {
 	logo, _, err := image.Decode(bytes.NewReader(wfmuLogoBytes))
 	if err != nil {
-		log.Fatalf("Could not decode WFMU logo: %w", err)
+		log.Fatalf("Could not decode WFMU logo: %v", err)
 	}
 
 	return &Wfmu{
@@ -47,49 +70,56 @@ func (wfmu *Wfmu) Logo() image.Image {
 	return wfmu.logo
 }
 
-func (wfmu *Wfmu) StreamCmd() *exec.Cmd {
-	str := "http://stream0.wfmu.org/freeform-high.aac"
-	return exec.Command("mpv", "-no-video", str)
+func (wfmu *Wfmu) Stream() player.Stream {
+	return player.FromSources(
+		player.Source{URL: "http://stream0.wfmu.org/freeform-high.aac"},
+		player.Source{URL: "http://stream0.wfmu.org/freeform-128k", Bitrate: 128},
+	)
 }
 
-func (wfmu *Wfmu) Status() Status {
-	var s Status
-
-	resp, err := http.Get("https://wfmu.org/wp-content/themes/wfmu-theme/status/main.json")
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		s.Show = err.Error()
-		return s
-	}
-
-	var f interface{}
-	if err := json.Unmarshal(body, &f); err != nil {
-		s.Show = err.Error()
-		return s
-	}
+func (wfmu *Wfmu) MetadataURL() string {
+	return wfmuMetadataURL
+}
 
-	m, ok := f.(map[string]interface{})
-	if !ok {
-		return s
-	}
+func (wfmu *Wfmu) Status() Status {
+	return wfmuMetadata.Status()
+}
 
-	if show, ok := m["show"].(string); ok {
-		s.Show = show
-	}
-	if album, ok := m["album"].(string); ok {
-		s.Album = album
-	}
-	if artist, ok := m["artist"].(string); ok {
-		s.Artist = artist
-	}
-	if track, ok := m["title"].(string); ok {
-		s.Artist = track
-	}
-	return s
+// Episodes returns the shows most recently added to the WFMU archive.
+func (wfmu *Wfmu) Episodes() ([]Episode, error) {
+	return wfmu.archive.get(func() ([]Episode, error) {
+		resp, err := http.Get("https://wfmu.org/archivefeed/mp3.xml")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("WFMU archive failed: %s", resp.Status)
+		}
+		var feed wfmuArchiveFeed
+		if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+			return nil, err
+		}
+
+		var eps []Episode
+		for _, it := range feed.Items {
+			if it.Enclosure.URL == "" {
+				continue
+			}
+			// Titles are like "Show Name: Playlist from Jan 2, 2024".
+			show, title, _ := strings.Cut(it.Title, ": ")
+			aired, _ := time.Parse(time.RFC1123Z, it.PubDate)
+			eps = append(eps, Episode{
+				ID:    it.Enclosure.URL,
+				Show:  strings.TrimSpace(show),
+				Title: strings.TrimSpace(title),
+				Aired: aired,
+			})
+		}
+		return eps, nil
+	})
+}
 
+func (wfmu *Wfmu) EpisodeStream(ep Episode) (player.Stream, error) {
+	return player.Stream{URL: ep.ID}, nil
 }
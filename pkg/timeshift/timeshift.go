@@ -0,0 +1,402 @@
+// Package timeshift records a live stream to a rolling buffer on disk, so
+// that it can be paused and rewound.
+package timeshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+// rateWarmup is how long to record before trusting the measured byte rate
+// over the nominal one.
+const rateWarmup = 10 * time.Second
+
+// recordRetry and recordRetryMax bound the wait before reconnecting to a
+// stream that failed.
+const (
+	recordRetry    = time.Second
+	recordRetryMax = time.Minute
+)
+
+// ErrClosed is returned by reads from a closed buffer.
+var ErrClosed = errors.New("timeshift buffer closed")
+
+// Buffer is a ring buffer in a file. Offsets are absolute, counting every
+// byte ever written, and only the last size bytes are kept.
+type Buffer struct {
+	f    *os.File
+	size int64
+	// rate is the nominal byte rate, used until the real one is known.
+	rate float64
+	now  func() time.Time
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written int64
+	// writing is the offset that the write in progress goes up to, or
+	// written between writes.
+	writing int64
+	started time.Time
+	closed  bool
+}
+
+// NewBuffer creates a buffer of size bytes in the file at path, for a stream
+// of about rate bytes per second.
+func NewBuffer(path string, size int64, rate float64) (*Buffer, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	b := &Buffer{f: f, size: size, rate: rate, now: time.Now}
+	b.cond = sync.NewCond(&b.mu)
+	return b, nil
+}
+
+// Write appends p, overwriting the oldest data once the buffer is full.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return 0, ErrClosed
+	}
+	if b.started.IsZero() {
+		b.started = b.now()
+	}
+	off := b.written
+	b.writing = off + int64(len(p))
+	b.mu.Unlock()
+
+	// Only this goroutine writes, so the file can be written unlocked.
+	n := 0
+	for n < len(p) {
+		pos := (off + int64(n)) % b.size
+		chunk := p[n:]
+		if room := b.size - pos; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		m, err := b.f.WriteAt(chunk, pos)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	b.mu.Lock()
+	b.written += int64(n)
+	b.writing = b.written
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	return n, nil
+}
+
+// Live returns the offset of the live edge.
+func (b *Buffer) Live() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.written
+}
+
+// Oldest returns the offset of the oldest data still in the buffer.
+func (b *Buffer) Oldest() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.oldestLocked()
+}
+
+func (b *Buffer) oldestLocked() int64 {
+	if b.written > b.size {
+		return b.written - b.size
+	}
+	return 0
+}
+
+// safeLocked returns the offset of the oldest data that the write in
+// progress, if any, is not overwriting.
+func (b *Buffer) safeLocked() int64 {
+	if b.writing > b.size {
+		return b.writing - b.size
+	}
+	return 0
+}
+
+// Rate returns the stream's byte rate, as measured once enough has been
+// recorded.
+func (b *Buffer) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started.IsZero() {
+		return b.rate
+	}
+	elapsed := b.now().Sub(b.started)
+	if elapsed < rateWarmup || b.written == 0 {
+		return b.rate
+	}
+	return float64(b.written) / elapsed.Seconds()
+}
+
+// NewReader returns a reader starting at offset off, which waits for new data
+// at the live edge. If the reader falls so far behind that its data is
+// overwritten, it skips ahead to the oldest data left.
+func (b *Buffer) NewReader(off int64) io.ReadCloser {
+	return &reader{b: b, off: off}
+}
+
+type reader struct {
+	b      *Buffer
+	off    int64
+	closed bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	b := r.b
+	for {
+		b.mu.Lock()
+		for b.written <= r.off && !b.closed && !r.closed {
+			b.cond.Wait()
+		}
+		if b.closed || r.closed {
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		if safe := b.safeLocked(); r.off < safe {
+			r.off = safe
+		}
+		avail := b.written - r.off
+		b.mu.Unlock()
+		if avail <= 0 {
+			continue
+		}
+
+		buf := p
+		if int64(len(buf)) > avail {
+			buf = buf[:avail]
+		}
+		pos := r.off % b.size
+		if room := b.size - pos; int64(len(buf)) > room {
+			buf = buf[:room]
+		}
+		n, err := b.f.ReadAt(buf, pos)
+
+		// The file is read unlocked, so a write may have started over the
+		// start of what was read meanwhile. Drop that part.
+		b.mu.Lock()
+		safe := b.safeLocked()
+		b.mu.Unlock()
+		if lost := safe - r.off; lost > 0 {
+			if lost >= int64(n) {
+				if err != nil {
+					return 0, err
+				}
+				r.off = safe
+				continue
+			}
+			n = copy(p, buf[lost:n])
+			r.off = safe
+		}
+		r.off += int64(n)
+		return n, err
+	}
+}
+
+func (r *reader) Close() error {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	r.closed = true
+	r.b.cond.Broadcast()
+	return nil
+}
+
+// Close stops the buffer and removes its file.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	err := b.f.Close()
+	os.Remove(b.f.Name())
+	return err
+}
+
+// Shifter records a stream into a Buffer and keeps track of where in it the
+// listener is. Positions are worked out from the time played, since players
+// read ahead of what they play.
+type Shifter struct {
+	buf    *Buffer
+	cancel context.CancelFunc
+	now    func() time.Time
+
+	// off is the offset the player started playing from at since.
+	off    int64
+	since  time.Time
+	paused bool
+}
+
+// Start starts recording s into a buffer at path, holding length of audio at
+// a nominal bitrate in kbps. Streams that are played by a command can not be
+// recorded.
+func Start(s player.Stream, path string, length time.Duration, bitrate int) (*Shifter, error) {
+	if len(s.Cmd) > 0 {
+		return nil, fmt.Errorf("can not record a command's stream")
+	}
+	rate := float64(bitrate) * 1000 / 8
+	buf, err := NewBuffer(path, int64(rate*length.Seconds()), rate)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sh := &Shifter{buf: buf, cancel: cancel, now: time.Now}
+	go func() {
+		if err := record(ctx, s, buf); err != nil {
+			log.Printf("timeshift: recording stopped: %v", err)
+		}
+	}()
+	sh.since = sh.now()
+	return sh, nil
+}
+
+// record copies s to w until ctx is done or w is closed, reconnecting
+// whenever the stream fails or ends. The wait between attempts doubles up to
+// recordRetryMax while they fail without getting any data.
+func record(ctx context.Context, s player.Stream, w io.Writer) error {
+	wait := recordRetry
+	for {
+		n, err := recordOnce(ctx, s, w)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrClosed) {
+			return err
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		if n > 0 {
+			wait = recordRetry
+		}
+		log.Printf("timeshift: recording failed: %v; reconnecting in %v", err, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+		if wait *= 2; wait > recordRetryMax {
+			wait = recordRetryMax
+		}
+	}
+}
+
+// recordOnce copies s to w over a single connection, returning how much it
+// copied.
+func recordOnce(ctx context.Context, s player.Stream, w io.Writer) (int64, error) {
+	var r io.ReadCloser
+	if s.Open != nil {
+		var err error
+		if r, err = s.Open(); err != nil {
+			return 0, err
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, fmt.Errorf("GET failed: %s", resp.Status)
+		}
+		r = resp.Body
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		r.Close()
+	}()
+	return io.Copy(w, r)
+}
+
+// Stream returns the stream to play from the current position. Players must
+// be restarted with it after every Seek and Live.
+func (sh *Shifter) Stream() player.Stream {
+	off := sh.off
+	return player.Stream{Open: func() (io.ReadCloser, error) {
+		return sh.buf.NewReader(off), nil
+	}}
+}
+
+// pos returns the offset being played now.
+func (sh *Shifter) pos() int64 {
+	if sh.paused {
+		return sh.off
+	}
+	played := int64(sh.now().Sub(sh.since).Seconds() * sh.buf.Rate())
+	pos := sh.off + played
+	if live := sh.buf.Live(); pos > live {
+		pos = live
+	}
+	return pos
+}
+
+// Pause notes that the player was paused.
+func (sh *Shifter) Pause() {
+	sh.off = sh.pos()
+	sh.paused = true
+}
+
+// Resume notes that the player was resumed.
+func (sh *Shifter) Resume() {
+	sh.since = sh.now()
+	sh.paused = false
+}
+
+// Seek moves the position by d, negative to rewind, within the buffer.
+func (sh *Shifter) Seek(d time.Duration) {
+	off := sh.pos() + int64(d.Seconds()*sh.buf.Rate())
+	if oldest := sh.buf.Oldest(); off < oldest {
+		off = oldest
+	}
+	if live := sh.buf.Live(); off > live {
+		off = live
+	}
+	sh.off = off
+	sh.since = sh.now()
+	sh.paused = false
+}
+
+// Live moves the position to the live edge.
+func (sh *Shifter) Live() {
+	sh.off = sh.buf.Live()
+	sh.since = sh.now()
+	sh.paused = false
+}
+
+// Behind returns how far behind live the position is.
+func (sh *Shifter) Behind() time.Duration {
+	rate := sh.buf.Rate()
+	if rate <= 0 {
+		return 0
+	}
+	secs := float64(sh.buf.Live()-sh.pos()) / rate
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Close stops recording and removes the buffer.
+func (sh *Shifter) Close() error {
+	sh.cancel()
+	return sh.buf.Close()
+}
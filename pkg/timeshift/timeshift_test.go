@@ -0,0 +1,164 @@
+package timeshift
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/player"
+)
+
+// recSize is the size of the records written in the tests, each holding its
+// own offset.
+const recSize = 8
+
+func TestBufferWrap(t *testing.T) {
+	b, err := NewBuffer(filepath.Join(t.TempDir(), "buf"), 4*recSize, 1000)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+	r := b.NewReader(0)
+	write(t, b, 0, 6)
+	if got, want := b.Oldest(), int64(2*recSize); got != want {
+		t.Errorf("Oldest = %d, want %d", got, want)
+	}
+	if got, want := b.Live(), int64(6*recSize); got != want {
+		t.Errorf("Live = %d, want %d", got, want)
+	}
+
+	// The reader fell behind, so it skips to the oldest data left, and
+	// reads across the end of the file.
+	p := make([]byte, 4*recSize)
+	n, err := io.ReadFull(r, p)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	for i := 0; i < n/recSize; i++ {
+		if got, want := binary.BigEndian.Uint64(p[i*recSize:]), uint64((2+i)*recSize); got != want {
+			t.Errorf("record %d = %d, want %d", i, got, want)
+		}
+	}
+
+	r.Close()
+	if _, err := r.Read(p); err != io.EOF {
+		t.Errorf("Read after Close = %v, want EOF", err)
+	}
+}
+
+// TestBufferRace has a reader chase a writer around a small buffer. Reads
+// must never return data that the writer was overwriting.
+func TestBufferRace(t *testing.T) {
+	b, err := NewBuffer(filepath.Join(t.TempDir(), "buf"), 16*recSize, 1000)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	const total = 20000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i += 3 {
+			if _, err := b.Write(records(i, 3)); err != nil {
+				// The test is over.
+				return
+			}
+		}
+	}()
+	defer func() {
+		b.Close()
+		<-done
+	}()
+
+	r := b.NewReader(0)
+	p := make([]byte, 5*recSize)
+	last := int64(-recSize)
+	deadline := time.Now().Add(10 * time.Second)
+	for last < (total-1)*recSize && time.Now().Before(deadline) {
+		n, err := r.Read(p)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if n%recSize != 0 {
+			t.Fatalf("Read returned %d bytes, not whole records", n)
+		}
+		for i := 0; i < n; i += recSize {
+			off := int64(binary.BigEndian.Uint64(p[i:]))
+			// Skipping ahead is fine, but going back means the data was
+			// overwritten as it was read.
+			if off <= last {
+				t.Fatalf("read record %d after %d", off, last)
+			}
+			last = off
+		}
+	}
+}
+
+// write writes n records, starting with the i'th.
+func write(t *testing.T, b *Buffer, i, n int) {
+	if _, err := b.Write(records(i, n)); err != nil {
+		t.Errorf("Write failed: %v", err)
+	}
+}
+
+// records returns n records, starting with the i'th.
+func records(i, n int) []byte {
+	p := make([]byte, n*recSize)
+	for j := 0; j < n; j++ {
+		binary.BigEndian.PutUint64(p[j*recSize:], uint64((i+j)*recSize))
+	}
+	return p
+}
+
+// TestRecordReconnects checks that recording carries on after the stream
+// drops, and that closing the shifter wakes its readers.
+func TestRecordReconnects(t *testing.T) {
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&conns, 1)
+		w.Write([]byte("abcd"))
+	}))
+	defer srv.Close()
+
+	sh, err := Start(player.Stream{URL: srv.URL}, filepath.Join(t.TempDir(), "buf"), 10*time.Second, 8)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	r, err := sh.Stream().Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	got := make(chan string)
+	go func() {
+		p := make([]byte, 8)
+		n, _ := io.ReadFull(r, p)
+		got <- string(p[:n])
+	}()
+	select {
+	case s := <-got:
+		if s != "abcdabcd" {
+			t.Errorf("read %q, want the stream twice", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stream not recorded again after %d connections", atomic.LoadInt32(&conns))
+	}
+
+	go func() {
+		_, err := io.Copy(io.Discard, r)
+		got <- fmt.Sprint(err)
+	}()
+	sh.Close()
+	select {
+	case s := <-got:
+		if s != "<nil>" {
+			t.Errorf("reading after Close failed: %s", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+}
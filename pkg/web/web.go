@@ -1,40 +1,134 @@
 package web
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
-	"text/template"
+	"time"
 
 	"github.com/nlacasse/boss-radio/pkg/events"
+	"github.com/nlacasse/boss-radio/pkg/health"
+	"github.com/nlacasse/boss-radio/pkg/history"
+	"github.com/nlacasse/boss-radio/pkg/radiobrowser"
+	"github.com/nlacasse/boss-radio/pkg/recorder"
 	"github.com/nlacasse/boss-radio/pkg/station"
 )
 
+// historyPageSize is the number of entries shown on each history page.
+const historyPageSize = 50
+
 var evMap = map[string]events.Event{
-	"prev":     events.ButtonLeft,
-	"next":     events.ButtonRight,
-	"vol_up":   events.ButtonUp,
-	"vol_down": events.ButtonDown,
-	"power":    events.ButtonCenter,
+	"prev":     {Key: events.ButtonLeft, Gesture: events.Press},
+	"next":     {Key: events.ButtonRight, Gesture: events.Press},
+	"vol_up":   {Key: events.ButtonUp, Gesture: events.Press},
+	"vol_down": {Key: events.ButtonDown, Gesture: events.Press},
+	"mute":     {Key: events.Mute, Gesture: events.Press},
+	"pause":    {Key: events.Pause, Gesture: events.Press},
+	"rewind":   {Key: events.Rewind, Gesture: events.Press},
+	// A long press rewinds further.
+	"rewind_far": {Key: events.Rewind, Gesture: events.LongPress},
+	"live":       {Key: events.Live, Gesture: events.Press},
+	"forward":    {Key: events.Seek, Gesture: events.Set, Level: 30},
+	"record":     {Key: events.Record, Gesture: events.Press},
+	// The center button acts on release, so that it can be long-pressed.
+	"power": {Key: events.ButtonCenter, Gesture: events.Release},
 }
 
 type Status struct {
 	Power  bool
 	Name   string
 	Status station.Status
+	Muted  bool
+	Paused bool
+	Volume int
+
+	// TimeShift is set if the station can be rewound, and Behind is how far
+	// behind live it is, like "04:12".
+	TimeShift bool
+	Behind    string
+
+	// Archived is set while an archived episode is playing.
+	Archived bool
+
+	// Recording is set while the station is being recorded.
+	Recording bool
+
+	// Outputs are the names of the audio outputs, and Output is the index
+	// of the one in use.
+	Outputs []string
+	Output  int
+
+	// Stations are all the stations, and Station is the index of the one
+	// playing.
+	Stations []StationInfo
+	Station  int
+
+	// LUFS is the measured loudness of the stream, if HasLUFS.
+	LUFS    float64
+	HasLUFS bool
+}
+
+// StationInfo describes a station for the station picker.
+type StationInfo struct {
+	Name   string
+	Health health.Result
+	// Rebuffers is how many times the player waited for data in the last
+	// hour.
+	Rebuffers int
+}
+
+func (s Status) HasProgress() bool {
+	_, ok := s.Status.Progress(time.Now())
+	return ok
+}
+
+func (s Status) ProgressPercent() int {
+	p, _ := s.Status.Progress(time.Now())
+	return int(100 * p)
+}
+
+// ScheduleItem is an upcoming scheduled action.
+type ScheduleItem struct {
+	Time   time.Time
+	Rule   string
+	Action string
+}
+
+// Options holds the stores that the web UI reads from.
+type Options struct {
+	History   *history.Store
+	Bookmarks *history.Store
+	// RecordDir is the directory of recordings.
+	RecordDir string
+	// Stations are the stations, for browsing their archives.
+	Stations []station.Station
+	// Directory is searched for new stations.
+	Directory *radiobrowser.Client
 }
 
 type Web struct {
-	stMu   sync.RWMutex
-	status Status
+	opts Options
+
+	stMu     sync.RWMutex
+	status   Status
+	schedule []ScheduleItem
+	// archived is the station whose archive was last listed.
+	archived string
 
 	// mu ensures that only one web handler is run at a time. It is not used
 	// for data protection.
 	mu sync.Mutex
 }
 
-func New() *Web {
-	return &Web{}
+func New(opts Options) *Web {
+	return &Web{opts: opts}
 }
 
 func (w *Web) Update(status Status) {
@@ -43,11 +137,24 @@ func (w *Web) Update(status Status) {
 	w.status = status
 }
 
-func (w *Web) ListenAndUpdate(eventCh chan<- events.Event, statusCh <-chan Status) error {
+func (w *Web) UpdateSchedule(items []ScheduleItem) {
+	w.stMu.Lock()
+	defer w.stMu.Unlock()
+	w.schedule = items
+}
+
+// ListenAndUpdate serves the web UI. Events are sent to eventCh, after which
+// the new status is read from statusCh. Stations added from the directory are
+// sent to addCh.
+func (w *Web) ListenAndUpdate(eventCh chan<- events.Event, statusCh <-chan Status, addCh chan<- radiobrowser.Station) error {
 	t, err := template.New("FreqM0d").Parse(tpl)
 	if err != nil {
 		return err
 	}
+	schedT, err := template.New("schedule").Parse(scheduleTpl)
+	if err != nil {
+		return err
+	}
 	http.HandleFunc("/", func(res http.ResponseWriter, _ *http.Request) {
 		log.Printf("serving /")
 		w.stMu.RLock()
@@ -57,28 +164,295 @@ func (w *Web) ListenAndUpdate(eventCh chan<- events.Event, statusCh <-chan Statu
 			log.Printf("Template failed: %v", err)
 		}
 	})
+	http.HandleFunc("/schedule", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /schedule")
+		w.stMu.RLock()
+		items := w.schedule
+		defer w.stMu.RUnlock()
+		if err := schedT.Execute(res, items); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	histT, err := template.New("history").Parse(historyTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/history", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /history")
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page < 0 {
+			page = 0
+		}
+		es, total, err := w.opts.History.List(page*historyPageSize, historyPageSize)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data := historyPage{Entries: es}
+		if page > 0 {
+			data.Prev = strconv.Itoa(page - 1)
+		}
+		if (page+1)*historyPageSize < total {
+			data.Next = strconv.Itoa(page + 1)
+		}
+		if err := histT.Execute(res, data); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	http.HandleFunc("/history.json", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /history.json")
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = historyPageSize
+		}
+		es, total, err := w.opts.History.List(offset, limit)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(struct {
+			Total   int             `json:"total"`
+			Entries []history.Entry `json:"entries"`
+		}{total, es})
+	})
+	http.HandleFunc("/history.csv", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /history.csv")
+		es, err := w.opts.History.All()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "text/csv")
+		res.Header().Set("Content-Disposition", `attachment; filename="history.csv"`)
+		cw := csv.NewWriter(res)
+		cw.Write([]string{"time", "station", "show", "artist", "track", "album"})
+		for _, e := range es {
+			cw.Write([]string{e.Time.Format(time.RFC3339), e.Station, e.Show, e.Artist, e.Track, e.Album})
+		}
+		cw.Flush()
+	})
+	bkmkT, err := template.New("bookmarks").Parse(bookmarksTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/bookmarks", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /bookmarks")
+		es, err := w.opts.Bookmarks.All()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var bs []bookmark
+		for i := len(es) - 1; i >= 0; i-- {
+			bs = append(bs, newBookmark(es[i]))
+		}
+		if err := bkmkT.Execute(res, bs); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	recT, err := template.New("recordings").Parse(recordingsTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/recordings", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /recordings")
+		recs, err := recorder.List(w.opts.RecordDir)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var rs []recording
+		for _, r := range recs {
+			rs = append(rs, newRecording(r))
+		}
+		if err := recT.Execute(res, rs); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	archT, err := template.New("archive").Parse(archiveTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/archive", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /archive")
+		w.stMu.RLock()
+		name := w.status.Name
+		w.stMu.RUnlock()
+		data := archivePage{Station: name}
+		for _, stn := range w.opts.Stations {
+			if a, ok := stn.(station.Archiver); ok && stn.Name() == name {
+				eps, err := a.Episodes()
+				if err != nil {
+					http.Error(res, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				data.HasArchive = true
+				data.Episodes = eps
+			}
+		}
+		w.stMu.Lock()
+		w.archived = name
+		w.stMu.Unlock()
+		if err := archT.Execute(res, data); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	http.HandleFunc("/archive/play", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /archive/play")
+		// Episodes are picked by ID, since the list may have changed since
+		// the page was served.
+		id := req.FormValue("episode")
+		w.stMu.RLock()
+		ok := w.archived == w.status.Name && id != ""
+		w.stMu.RUnlock()
+		if !ok {
+			http.Error(res, "bad episode", http.StatusBadRequest)
+			return
+		}
+		w.send(eventCh, statusCh, events.Event{Key: events.Archive, Gesture: events.Set, ID: id})
+		http.Redirect(res, req, "/", 303)
+	})
+	dirT, err := template.New("directory").Funcs(template.FuncMap{"httpURL": httpURL}).Parse(directoryTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/directory", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /directory")
+		q := radiobrowser.Query{
+			Name:    strings.TrimSpace(req.FormValue("name")),
+			Tag:     strings.TrimSpace(req.FormValue("tag")),
+			Country: strings.TrimSpace(req.FormValue("country")),
+		}
+		data := directoryPage{Query: q, Added: req.FormValue("added")}
+		if q != (radiobrowser.Query{}) {
+			stns, err := w.opts.Directory.Search(q)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadGateway)
+				return
+			}
+			data.Searched = true
+			data.Results = stns
+		}
+		if err := dirT.Execute(res, data); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+	http.HandleFunc("/directory/add", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /directory/add")
+		uuid := req.FormValue("uuid")
+		if uuid == "" {
+			http.Error(res, "missing uuid", http.StatusBadRequest)
+			return
+		}
+		// Take the station from the directory rather than the form, so
+		// that only stations in it can be added to the config.
+		rs, err := w.opts.Directory.Station(uuid)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadGateway)
+			return
+		}
+		rs.Name = strings.TrimSpace(rs.Name)
+		if rs.Name == "" || httpURL(rs.StreamURL()) == "" {
+			http.Error(res, "station has no name or stream", http.StatusBadRequest)
+			return
+		}
+		// Count the click, as the directory asks.
+		if u, err := w.opts.Directory.Click(rs.UUID); err != nil {
+			log.Printf("Click failed: %v", err)
+		} else if httpURL(u) != "" {
+			rs.ResolvedURL = u
+		}
+		addCh <- rs
+		http.Redirect(res, req, "/directory?added="+url.QueryEscape(rs.Name), 303)
+	})
+	http.Handle("/recordings/files/", http.StripPrefix("/recordings/files/", http.FileServer(http.Dir(w.opts.RecordDir))))
 	for str, ev := range evMap {
 		sstr := str
 		sev := ev
 		http.HandleFunc("/"+str, func(res http.ResponseWriter, req *http.Request) {
-			w.mu.Lock()
-			defer w.mu.Unlock()
 			log.Printf("serving /%s", sstr)
-			eventCh <- sev
-			// Wait for return event.
-			st := <-statusCh
-			w.stMu.Lock()
-			w.status = st
-			w.stMu.Unlock()
+			w.send(eventCh, statusCh, sev)
 			http.Redirect(res, req, "/", 307)
 		})
 	}
+	http.HandleFunc("/volume", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /volume")
+		level, err := strconv.Atoi(req.FormValue("level"))
+		if err != nil {
+			http.Error(res, "bad level", http.StatusBadRequest)
+			return
+		}
+		w.send(eventCh, statusCh, events.Event{Key: events.Volume, Gesture: events.Set, Level: level})
+		http.Redirect(res, req, "/", 303)
+	})
+
+	http.HandleFunc("/station", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /station")
+		i, err := strconv.Atoi(req.FormValue("index"))
+		if err != nil {
+			http.Error(res, "bad station", http.StatusBadRequest)
+			return
+		}
+		w.send(eventCh, statusCh, events.Event{Key: events.Tune, Gesture: events.Set, Level: i})
+		http.Redirect(res, req, "/", 303)
+	})
+	healthT, err := template.New("health").Parse(healthTpl)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/health", func(res http.ResponseWriter, _ *http.Request) {
+		log.Printf("serving /health")
+		w.stMu.RLock()
+		stns := w.status.Stations
+		w.stMu.RUnlock()
+		if err := healthT.Execute(res, stns); err != nil {
+			log.Printf("Template failed: %v", err)
+		}
+	})
+
+	http.HandleFunc("/output", func(res http.ResponseWriter, req *http.Request) {
+		log.Printf("serving /output")
+		i, err := strconv.Atoi(req.FormValue("index"))
+		w.stMu.RLock()
+		n := len(w.status.Outputs)
+		w.stMu.RUnlock()
+		if err != nil || i < 0 || i >= n {
+			http.Error(res, "bad output", http.StatusBadRequest)
+			return
+		}
+		w.send(eventCh, statusCh, events.Event{Key: events.Output, Gesture: events.Set, Level: i})
+		http.Redirect(res, req, "/", 303)
+	})
 
 	go http.ListenAndServe(":8000", nil)
 
 	return nil
 }
 
+// httpURL returns u if it is an http or https URL, and "" otherwise, so that
+// links from third parties can not run scripts.
+func httpURL(u string) string {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") {
+		return ""
+	}
+	return u
+}
+
+// send sends ev to the radio and waits for its new status.
+func (w *Web) send(eventCh chan<- events.Event, statusCh <-chan Status, ev events.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	eventCh <- ev
+	// Wait for return event.
+	st := <-statusCh
+	w.stMu.Lock()
+	w.status = st
+	w.stMu.Unlock()
+}
+
 const tpl = `
 <!DOCTYPE html>
 <html>
@@ -108,6 +482,21 @@ const tpl = `
 				color:red;
 				text-shadow: -1px 0 black, 0 1px black, 1px 0 black, 0 -1px black;
 			}
+			input[type=range] {
+				width: 80%;
+				accent-color: red;
+			}
+			select {
+				font-family: monospace;
+				font-size: 1em;
+				background-color: black;
+				color: red;
+			}
+			progress {
+				width: 80%;
+				height: 2em;
+				accent-color: red;
+			}
 			a:link {
 			  text-decoration: none;
 			}
@@ -128,22 +517,505 @@ const tpl = `
 	</head>
 	<body>
 		{{if .Power}}
-			<h1>{{.Name}}</h1>
+			<form action="/station" method="post">
+				<h1>
+				<select name="index" onchange="this.form.submit()">
+					{{$cur := .Station}}
+					{{range $i, $s := .Stations}}
+						<option value="{{$i}}"{{if eq $i $cur}} selected{{end}}>{{if not $s.Health.OK}}&#9888; {{end}}{{$s.Name}}</option>
+					{{end}}
+				</select>
+				</h1>
+			</form>
+			{{if .Muted}}<h2>[MUTE]</h2>{{end}}
+			{{if .Paused}}<h2>[PAUSED]</h2>{{end}}
 			<h2>{{.Status.Show}}</h2>
 			<h2>{{.Status.Artist}}</h2>
 			<h2>{{.Status.Track}}</h2>
 			<h2>{{.Status.Album}}</h2>
+			{{if .HasProgress}}
+				<progress max="100" value="{{.ProgressPercent}}"></progress>
+				<h2>{{.Status.Start.Local.Format "15:04"}} - {{.Status.End.Local.Format "15:04"}}</h2>
+			{{end}}
+			{{if .Status.Next}}
+				<h2>Next: {{.Status.Next}}</h2>
+			{{end}}
+			{{if not .Status.ProgramTime.IsZero}}
+				<h2>Aired {{.Status.ProgramTime.Local.Format "15:04:05"}}</h2>
+			{{end}}
 			<br><br>
 			<a href="/prev"><h1>PREV</h1></a>
 			<a href="/next"><h1>NEXT</h1></a>
 			<br>
 			<a href="/vol_up"><h1>VOL UP</h1></a>
 			<a href="/vol_down"><h1>VOL DOWN</h1></a>
+			<form action="/volume" method="post">
+				<input type="range" name="level" min="0" max="100" value="{{.Volume}}" onchange="this.form.submit()">
+				<h2>VOLUME {{.Volume}}{{if .HasLUFS}} ({{printf "%.1f" .LUFS}} LUFS){{end}}</h2>
+			</form>
+			<a href="/mute"><h1>{{if .Muted}}UNMUTE{{else}}MUTE{{end}}</h1></a>
+			<a href="/pause"><h1>{{if .Paused}}RESUME{{else}}PAUSE{{end}}</h1></a>
+			<a href="/record"><h1>{{if .Recording}}STOP RECORDING{{else}}RECORD{{end}}</h1></a>
+			{{if .TimeShift}}
+				{{if .Behind}}<h2>-{{.Behind}}</h2>{{end}}
+				<a href="/rewind"><h1>-30S</h1></a>
+				<a href="/rewind_far"><h1>-5M</h1></a>
+				{{if .Behind}}<a href="/live"><h1>LIVE</h1></a>{{end}}
+			{{end}}
+			{{if .Archived}}
+				<a href="/rewind"><h1>-30S</h1></a>
+				<a href="/rewind_far"><h1>-5M</h1></a>
+				<a href="/forward"><h1>+30S</h1></a>
+				<a href="/live"><h1>LIVE</h1></a>
+			{{end}}
+			{{if gt (len .Outputs) 1}}
+				<form action="/output" method="post">
+					<h2>OUTPUT
+					<select name="index" onchange="this.form.submit()">
+						{{$cur := .Output}}
+						{{range $i, $name := .Outputs}}
+							<option value="{{$i}}"{{if eq $i $cur}} selected{{end}}>{{$name}}</option>
+						{{end}}
+					</select>
+					</h2>
+				</form>
+			{{end}}
 			<br>
 			<a href="/power"><h1>TURN OFF</h1></a><br>
 		{{else}}
 			<a href="/power"><h1>TURN ON</h1></a><br>
 		{{end}}
+		<a href="/schedule"><h2>SCHEDULE</h2></a>
+		<a href="/history"><h2>HISTORY</h2></a>
+		<a href="/bookmarks"><h2>BOOKMARKS</h2></a>
+		<a href="/recordings"><h2>RECORDINGS</h2></a>
+		{{if .Power}}<a href="/archive"><h2>ARCHIVE</h2></a>{{end}}
+		<a href="/directory"><h2>FIND STATIONS</h2></a>
+		{{if .Power}}<a href="/health"><h2>HEALTH</h2></a>{{end}}
+	<body>
+</html>
+`
+
+const scheduleTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Schedule</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 2em;
+			}
+			a:link, a:visited {
+			  color: red;
+			  text-decoration: none;
+			}
+			td {
+				padding-right: 1em;
+			}
+		</style>
+		<meta http-equiv="refresh" content="60" />
+	</head>
+	<body>
+		<h1>UP NEXT</h1>
+		{{if .}}
+		<table>
+			{{range .}}
+			<tr>
+				<td>{{.Time.Format "Mon Jan 2 15:04"}}</td>
+				<td>{{.Action}}</td>
+				<td>({{.Rule}})</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else}}
+			<p>Nothing scheduled.</p>
+		{{end}}
+		<br>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+type historyPage struct {
+	Entries    []history.Entry
+	Prev, Next string
+}
+
+const historyTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d History</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			  text-decoration: none;
+			}
+			td {
+				padding-right: 1em;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>HISTORY</h1>
+		<table>
+			<tr><th>Time</th><th>Station</th><th>Show</th><th>Artist</th><th>Track</th><th>Album</th></tr>
+			{{range .Entries}}
+			<tr>
+				<td>{{.Time.Local.Format "Mon Jan 2 15:04"}}</td>
+				<td>{{.Station}}</td>
+				<td>{{.Show}}</td>
+				<td>{{.Artist}}</td>
+				<td>{{.Track}}</td>
+				<td>{{.Album}}</td>
+			</tr>
+			{{end}}
+		</table>
+		<br>
+		{{if .Prev}}<a href="/history?page={{.Prev}}">NEWER</a>{{end}}
+		{{if .Next}}<a href="/history?page={{.Next}}">OLDER</a>{{end}}
+		<br><br>
+		<a href="/history.csv">CSV</a>
+		<a href="/history.json">JSON</a>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+// bookmark is a bookmarked entry along with links to search for it.
+type bookmark struct {
+	history.Entry
+	Google   string
+	Discogs  string
+	Bandcamp string
+}
+
+func newBookmark(e history.Entry) bookmark {
+	var terms []string
+	for _, t := range []string{e.Artist, e.Track} {
+		if t != "" {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		terms = []string{e.Show, e.Station}
+	}
+	q := strings.Join(terms, " ")
+	eq := url.QueryEscape(q)
+	return bookmark{
+		Entry:    e,
+		Google:   "https://www.google.com/search?q=" + eq,
+		Discogs:  "https://www.discogs.com/search/?q=" + eq,
+		Bandcamp: "https://bandcamp.com/search?q=" + eq,
+	}
+}
+
+const bookmarksTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Bookmarks</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			}
+			td {
+				padding-right: 1em;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>&hearts; BOOKMARKS</h1>
+		{{if .}}
+		<table>
+			<tr><th>Time</th><th>Station</th><th>Show</th><th>Artist</th><th>Track</th><th>Album</th><th>Search</th></tr>
+			{{range .}}
+			<tr>
+				<td>{{.Time.Local.Format "Mon Jan 2 15:04"}}</td>
+				<td>{{.Station}}</td>
+				<td>{{.Show}}</td>
+				<td>{{.Artist}}</td>
+				<td>{{.Track}}</td>
+				<td>{{.Album}}</td>
+				<td>
+					<a href="{{.Google}}">Google</a>
+					<a href="{{.Discogs}}">Discogs</a>
+					<a href="{{.Bandcamp}}">Bandcamp</a>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else}}
+			<p>No bookmarks yet. Long-press the center button or press MENU on the remote.</p>
+		{{end}}
+		<br>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+type recording struct {
+	recorder.Recording
+	Href   string
+	Length string
+	SizeMB string
+}
+
+func newRecording(r recorder.Recording) recording {
+	rec := recording{
+		Recording: r,
+		Href:      "/recordings/files/" + url.PathEscape(r.File),
+		SizeMB:    fmt.Sprintf("%.1f", float64(r.Size)/(1<<20)),
+	}
+	if !r.End.IsZero() {
+		rec.Length = r.End.Sub(r.Start).Round(time.Minute).String()
+	}
+	return rec
+}
+
+const recordingsTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Recordings</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			}
+			td {
+				padding-right: 1em;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>RECORDINGS</h1>
+		{{if .}}
+		<table>
+			<tr><th>Start</th><th>Station</th><th>Show</th><th>Length</th><th>MB</th><th>Tracks</th></tr>
+			{{range .}}
+			<tr>
+				<td>{{.Start.Local.Format "Mon Jan 2 15:04"}}</td>
+				<td>{{.Station}}</td>
+				<td><a href="{{.Href}}" download>{{if .Show}}{{.Show}}{{else}}{{.File}}{{end}}</a></td>
+				<td>{{if .Length}}{{.Length}}{{else}}recording{{end}}</td>
+				<td>{{.SizeMB}}</td>
+				<td>{{len .Tracks}}</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else}}
+			<p>No recordings yet. Press RECORD, or add a "record" rule to the schedule.</p>
+		{{end}}
+		<br>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+// archivePage lists the archived episodes of the current station.
+type archivePage struct {
+	Station    string
+	HasArchive bool
+	Episodes   []station.Episode
+}
+
+const archiveTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Archive</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			}
+			td {
+				padding-right: 1em;
+			}
+			button {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				border: 1px solid red;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>{{.Station}} ARCHIVE</h1>
+		{{if .Episodes}}
+		<table>
+			<tr><th>Aired</th><th>Show</th><th>Title</th><th></th></tr>
+			{{range $ep := .Episodes}}
+			<tr>
+				<td>{{if not $ep.Aired.IsZero}}{{$ep.Aired.Local.Format "Mon Jan 2 15:04"}}{{end}}</td>
+				<td>{{$ep.Show}}</td>
+				<td>{{$ep.Title}}</td>
+				<td>
+					<form action="/archive/play" method="post">
+						<input type="hidden" name="episode" value="{{$ep.ID}}">
+						<button type="submit">PLAY</button>
+					</form>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else if .HasArchive}}
+			<p>No archived episodes.</p>
+		{{else}}
+			<p>{{if .Station}}{{.Station}} has no archive.{{else}}Turn the radio on to browse its archive.{{end}}</p>
+		{{end}}
+		<br>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+// directoryPage is a search of the station directory.
+type directoryPage struct {
+	Query    radiobrowser.Query
+	Searched bool
+	Results  []radiobrowser.Station
+	// Added is the name of the station just added, if any.
+	Added string
+}
+
+const directoryTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Directory</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			}
+			td {
+				padding-right: 1em;
+			}
+			input, button {
+				font-family: monospace;
+				font-size: 1em;
+				background-color: black;
+				color: red;
+				border: 1px solid red;
+			}
+			audio {
+				height: 2em;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>FIND STATIONS</h1>
+		{{if .Added}}<p>Added {{.Added}}.</p>{{end}}
+		<form action="/directory" method="get">
+			<input type="text" name="name" placeholder="name" value="{{.Query.Name}}">
+			<input type="text" name="tag" placeholder="tag" value="{{.Query.Tag}}">
+			<input type="text" name="country" placeholder="country" value="{{.Query.Country}}">
+			<button type="submit">SEARCH</button>
+		</form>
+		{{if .Results}}
+		<table>
+			<tr><th>Name</th><th>Country</th><th>Tags</th><th>Format</th><th>Clicks</th><th>Preview</th><th></th></tr>
+			{{range .Results}}
+			<tr>
+				<td>{{$name := .Name}}{{with httpURL .Homepage}}<a href="{{.}}">{{$name}}</a>{{else}}{{.Name}}{{end}}</td>
+				<td>{{.Country}}</td>
+				<td>{{.Tags}}</td>
+				<td>{{.Codec}}{{if .Bitrate}} {{.Bitrate}}k{{end}}</td>
+				<td>{{.ClickCount}}</td>
+				<td>{{with httpURL .StreamURL}}<audio controls preload="none" src="{{.}}"></audio>{{end}}</td>
+				<td>
+					<form action="/directory/add" method="post">
+						<input type="hidden" name="uuid" value="{{.UUID}}">
+						<button type="submit">ADD</button>
+					</form>
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else if .Searched}}
+			<p>No stations found.</p>
+		{{end}}
+		<br>
+		<a href="/">BACK</a>
+	</body>
+</html>
+`
+
+const healthTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>FreqM0d Health</title>
+		<style type="text/css">
+			body {
+				font-family: monospace;
+				background-color: black;
+				color: red;
+				font-size: 1.5em;
+			}
+			a:link, a:visited {
+			  color: red;
+			}
+			td {
+				padding-right: 1em;
+			}
+		</style>
+		<meta http-equiv="refresh" content="60" />
+	</head>
 	<body>
+		<h1>HEALTH</h1>
+		<table>
+			<tr><th>Station</th><th>Checked</th><th>Stream</th><th>Metadata</th><th>Last OK</th><th>Rebuffers</th><th>Problem</th></tr>
+			{{range .}}
+			<tr>
+				<td>{{if not .Health.OK}}&#9888; {{end}}{{.Name}}</td>
+				{{if .Health.Checked.IsZero}}
+				<td>not yet</td><td></td><td></td><td></td><td>{{.Rebuffers}}</td><td></td>
+				{{else}}
+				<td>{{.Health.Checked.Local.Format "15:04"}}</td>
+				<td>{{if .Health.Latency}}{{.Health.Latency.Milliseconds}}ms{{end}}</td>
+				<td>{{if .Health.MetadataLatency}}{{.Health.MetadataLatency.Milliseconds}}ms{{end}}</td>
+				<td>{{if .Health.LastOK.IsZero}}never{{else}}{{.Health.LastOK.Local.Format "Mon Jan 2 15:04"}}{{end}}</td>
+				<td>{{.Rebuffers}}</td>
+				<td>{{.Health.Problem}}</td>
+				{{end}}
+			</tr>
+			{{end}}
+		</table>
+		<br>
+		<a href="/">BACK</a>
+	</body>
 </html>
 `
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlacasse/boss-radio/pkg/health"
+	"github.com/nlacasse/boss-radio/pkg/history"
+	"github.com/nlacasse/boss-radio/pkg/radiobrowser"
+	"github.com/nlacasse/boss-radio/pkg/station"
+)
+
+func TestHTTPURL(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"https://wfmu.org/", "https://wfmu.org/"},
+		{"http://example.com:8000/stream", "http://example.com:8000/stream"},
+		{"javascript:alert(1)", ""},
+		{"JavaScript:alert(1)", ""},
+		{"data:text/html,hi", ""},
+		{"//example.com/", ""},
+		{"", ""},
+	} {
+		if got := httpURL(c.in); got != c.want {
+			t.Errorf("httpURL(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+// TestTemplatesEscape checks that names and metadata from stations and the
+// directory can not inject markup.
+func TestTemplatesEscape(t *testing.T) {
+	const evil = "<script>alert(1)</script>"
+	for _, c := range []struct {
+		name, tpl string
+		data      interface{}
+	}{
+		{"main", tpl, Status{
+			Power:    true,
+			Status:   station.Status{Show: evil, Artist: evil, Track: evil, Album: evil, Next: evil},
+			Stations: []StationInfo{{Name: evil}},
+			Outputs:  []string{evil, evil},
+		}},
+		{"health", healthTpl, []StationInfo{{Name: evil, Health: health.Result{Checked: time.Now(), Problem: evil}}}},
+		{"directory", directoryTpl, directoryPage{
+			Added:    evil,
+			Searched: true,
+			Results:  []radiobrowser.Station{{Name: evil, Homepage: "https://example.com/", Tags: evil}},
+		}},
+		{"archive", archiveTpl, archivePage{
+			Station:    evil,
+			HasArchive: true,
+			Episodes:   []station.Episode{{ID: evil, Show: evil, Title: evil}},
+		}},
+		{"history", historyTpl, historyPage{Entries: []history.Entry{{Station: evil, Show: evil, Artist: evil, Track: evil, Album: evil}}}},
+	} {
+		tmpl, err := template.New(c.name).Funcs(template.FuncMap{"httpURL": httpURL}).Parse(c.tpl)
+		if err != nil {
+			t.Fatalf("%s: Parse failed: %v", c.name, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, c.data); err != nil {
+			t.Fatalf("%s: Execute failed: %v", c.name, err)
+		}
+		if strings.Contains(b.String(), evil) {
+			t.Errorf("%s: page contains unescaped %s", c.name, evil)
+		}
+		if !strings.Contains(b.String(), template.HTMLEscapeString(evil)) {
+			t.Errorf("%s: page does not show the escaped name", c.name)
+		}
+	}
+}